@@ -0,0 +1,261 @@
+package ddp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+)
+
+// ConfigChangeFunc is called for each element of the config that a write changed.
+// old is nil for new elements and value is nil for removed ones.
+type ConfigChangeFunc func(key string, old, value json.RawMessage)
+
+// ConfigStore is a writable JSON config served on DDP_ID_CONFIG, see RegisterConfigStore.
+// The config is an object of elements: writes of {"config":{...}} replace only the
+// elements they name, an element written as null is removed. Writing "reboot" as
+// non-zero calls the reboot hook instead of being stored.
+type ConfigStore struct {
+	mu       sync.Mutex
+	elements map[string]json.RawMessage
+	schema   reflect.Type
+	path     string
+	onChange []ConfigChangeFunc
+	onReboot func()
+
+	writes jsonAssembler
+}
+
+// configWrite is the JSON envelope of a config write
+type configWrite struct {
+	Config map[string]json.RawMessage `json:"config"`
+}
+
+// NewConfigStore returns an empty config store
+func NewConfigStore() *ConfigStore {
+	return &ConfigStore{
+		elements: make(map[string]json.RawMessage),
+	}
+}
+
+// SetSchema makes writes valid only if the resulting config decodes into the type
+// of v, usually a struct such as Config, without unknown fields
+func (c *ConfigStore) SetSchema(v interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.schema = reflect.TypeOf(v)
+	if c.schema.Kind() == reflect.Ptr {
+		c.schema = c.schema.Elem()
+	}
+}
+
+// SetFile keeps the config in the file at path: it is loaded now if the file exists
+// and saved after every change
+func (c *ConfigStore) SetFile(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var doc configWrite
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if doc.Config != nil {
+		c.elements = doc.Config
+	}
+	return nil
+}
+
+// OnChange adds a callback for changed elements, called after the change is saved
+func (c *ConfigStore) OnChange(fn ConfigChangeFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.onChange = append(c.onChange, fn)
+}
+
+// OnReboot sets the hook called when "reboot" is written
+func (c *ConfigStore) OnReboot(fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.onReboot = fn
+}
+
+// Get decodes the element key into v, returning false if there is no such element
+func (c *ConfigStore) Get(key string, v interface{}) (bool, error) {
+	c.mu.Lock()
+	value, exists := c.elements[key]
+	c.mu.Unlock()
+
+	if !exists {
+		return false, nil
+	}
+	return true, json.Unmarshal(value, v)
+}
+
+// Set replaces the element key with v, as if it had been written over the network
+func (c *ConfigStore) Set(key string, v interface{}) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.merge(map[string]json.RawMessage{key: value})
+}
+
+// Document returns the config as served on a Query, {"config":{...}}
+func (c *ConfigStore) Document() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return json.Marshal(configWrite{Config: c.elements})
+}
+
+// Write applies a {"config":{...}} write
+func (c *ConfigStore) Write(data []byte) error {
+	var doc configWrite
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("invalid config write: %w", err)
+	}
+	if doc.Config == nil {
+		return errors.New(`config write has no "config" object`)
+	}
+	return c.merge(doc.Config)
+}
+
+// merge replaces the given elements, validates and saves the result, then runs the callbacks
+func (c *ConfigStore) merge(changes map[string]json.RawMessage) error {
+	c.mu.Lock()
+
+	merged := make(map[string]json.RawMessage, len(c.elements)+len(changes))
+	for key, value := range c.elements {
+		merged[key] = value
+	}
+	for key, value := range changes {
+		if bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+			delete(merged, key)
+		} else {
+			merged[key] = value
+		}
+	}
+
+	if err := c.validate(merged); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+
+	// Reboot is a command, not a setting
+	reboot := false
+	if value, exists := merged["reboot"]; exists {
+		var n int
+		reboot = json.Unmarshal(value, &n) == nil && n != 0
+		delete(merged, "reboot")
+	}
+
+	old := c.elements
+	c.elements = merged
+	if err := c.save(); err != nil {
+		c.elements = old
+		c.mu.Unlock()
+		return err
+	}
+
+	onChange := c.onChange
+	onReboot := c.onReboot
+	c.mu.Unlock()
+
+	for key := range changes {
+		if key == "reboot" || bytes.Equal(old[key], merged[key]) {
+			continue
+		}
+		for _, fn := range onChange {
+			fn(key, old[key], merged[key])
+		}
+	}
+	if reboot && onReboot != nil {
+		onReboot()
+	}
+	return nil
+}
+
+// validate checks elements against the schema, if one is set
+func (c *ConfigStore) validate(elements map[string]json.RawMessage) error {
+	if c.schema == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(elements)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(reflect.New(c.schema).Interface()); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	return nil
+}
+
+// save writes the config to its file, if it has one, replacing the file in one step
+func (c *ConfigStore) save() error {
+	if c.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(configWrite{Config: c.elements}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	return nil
+}
+
+// handlePacket collects the packets of a config write and applies it on Push
+func (c *ConfigStore) handlePacket(packet *DDPPacket, addr *net.UDPAddr) error {
+	data, complete, err := c.writes.add(packet, addr)
+	if err != nil || !complete {
+		return err
+	}
+	return c.Write(data)
+}
+
+// RegisterConfigStore serves store on DDP_ID_CONFIG: Queries read the config and
+// writes are merged into it once their Push arrives. Writes are limited to
+// MaxJSONSize and their packets have to arrive in order without long pauses.
+// Use DispatchOrdered so the packets of a write are handled in order.
+func (s *DDPServer) RegisterConfigStore(store *ConfigStore) {
+	s.RegisterDocument(DDP_ID_CONFIG, store.Document)
+	s.RegisterHandler(DDP_ID_CONFIG, store.handlePacket)
+}
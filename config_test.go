@@ -0,0 +1,222 @@
+package ddp
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test writes replace single elements and report each change
+func TestConfigStoreMerge(t *testing.T) {
+	store := NewConfigStore()
+
+	var changes []string
+	store.OnChange(func(key string, old, value json.RawMessage) {
+		changes = append(changes, key+":"+string(old)+">"+string(value))
+	})
+
+	if err := store.Write([]byte(`{"config":{"ip":"10.0.0.2","nm":"255.0.0.0"}}`)); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := store.Write([]byte(`{"config":{"ip":"10.0.0.3","nm":"255.0.0.0","gw":null}}`)); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := store.Write([]byte(`{"config":{"nm":null}}`)); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	doc, _ := store.Document()
+	if string(doc) != `{"config":{"ip":"10.0.0.3"}}` {
+		t.Errorf("Document = %s, expected only the ip", doc)
+	}
+
+	expected := map[string]bool{
+		`ip:>"10.0.0.2"`:           true,
+		`nm:>"255.0.0.0"`:          true,
+		`ip:"10.0.0.2">"10.0.0.3"`: true,
+		`nm:"255.0.0.0">`:          true,
+	}
+	if len(changes) != len(expected) {
+		t.Errorf("Changes = %v, expected %d", changes, len(expected))
+	}
+	for _, change := range changes {
+		if !expected[change] {
+			t.Errorf("Unexpected change %s", change)
+		}
+	}
+}
+
+// Test writes that don't fit the schema are rejected and leave the config alone
+func TestConfigStoreSchema(t *testing.T) {
+	store := NewConfigStore()
+	store.SetSchema(Config{})
+
+	if err := store.Set("ports", []PortConfig{{Port: 1, Lights: 50}}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := store.Write([]byte(`{"config":{"ports":"many"}}`)); err == nil {
+		t.Error("Expected an error for a wrongly typed element")
+	}
+	if err := store.Write([]byte(`{"config":{"colour":"red"}}`)); err == nil {
+		t.Error("Expected an error for an unknown element")
+	}
+
+	var ports []PortConfig
+	if found, err := store.Get("ports", &ports); !found || err != nil || len(ports) != 1 || ports[0].Lights != 50 {
+		t.Errorf("Get = %v, %v, %v, expected the ports set before", ports, found, err)
+	}
+}
+
+// Test reboot calls the hook and isn't stored
+func TestConfigStoreReboot(t *testing.T) {
+	store := NewConfigStore()
+	store.SetSchema(Config{})
+
+	rebooted := false
+	store.OnReboot(func() { rebooted = true })
+
+	if err := store.Write([]byte(`{"config":{"ip":"10.0.0.2","reboot":1}}`)); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if !rebooted {
+		t.Error("Reboot hook was not called")
+	}
+	if found, _ := store.Get("reboot", new(int)); found {
+		t.Error("reboot was stored, expected it to be dropped")
+	}
+}
+
+// Test the config is saved to its file and loaded again
+func TestConfigStoreFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+
+	store := NewConfigStore()
+	if err := store.SetFile(path); err != nil {
+		t.Fatalf("SetFile failed: %v", err)
+	}
+	if err := store.Set("ip", "10.0.0.2"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("Config was not saved: %v", err)
+	}
+
+	loaded := NewConfigStore()
+	if err := loaded.SetFile(path); err != nil {
+		t.Fatalf("SetFile failed: %v", err)
+	}
+	var ip string
+	if found, err := loaded.Get("ip", &ip); !found || err != nil || ip != "10.0.0.2" {
+		t.Errorf("Loaded ip = %q, %v, %v, expected 10.0.0.2", ip, found, err)
+	}
+}
+
+// Test the store over the network, with a write spread over several packets
+func TestConfigStoreServer(t *testing.T) {
+	store := NewConfigStore()
+	store.SetSchema(Config{})
+
+	changed := make(chan string, 10)
+	store.OnChange(func(key string, old, value json.RawMessage) {
+		changed <- key
+	})
+
+	server := NewDDPServer()
+	server.SetDispatchMode(DispatchOrdered)
+	server.RegisterConfigStore(store)
+	controller := newQueryServer(t, server)
+
+	ports := make([]PortConfig, 100)
+	for i := range ports {
+		ports[i] = PortConfig{Port: i + 1, Lights: 170}
+	}
+	if err := controller.SetConfig(Config{IP: "10.0.0.2", Ports: ports}); err != nil {
+		t.Fatalf("SetConfig failed: %v", err)
+	}
+
+	keys := map[string]bool{}
+	for len(keys) < 2 {
+		select {
+		case key := <-changed:
+			keys[key] = true
+		case <-time.After(time.Second):
+			t.Fatalf("Changed %v, expected ip and ports", keys)
+		}
+	}
+
+	config, err := controller.GetConfig()
+	if err != nil {
+		t.Fatalf("GetConfig failed: %v", err)
+	}
+	if config.IP != "10.0.0.2" || len(config.Ports) != 100 || config.Ports[99].Port != 100 {
+		t.Errorf("Config = %+v, expected the written config", config)
+	}
+
+	doc, _ := store.Document()
+	if !strings.Contains(string(doc), `"ip":"10.0.0.2"`) {
+		t.Errorf("Document = %s, expected the ip", doc)
+	}
+}
+
+// Test config writes that are too large, out of order or stalled are dropped
+func TestConfigStoreWriteLimits(t *testing.T) {
+	store := NewConfigStore()
+	store.writes.timeout = 20 * time.Millisecond
+
+	otherAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 4048}
+	writeFrom := func(addr *net.UDPAddr, offset uint32, push bool, data string) error {
+		h := DDPHeader{F1: ConfigFlag{Push: push}, ID: DDP_ID_CONFIG, Offset: offset, Length: uint16(len(data))}
+		return store.handlePacket(&DDPPacket{Header: h, Data: []byte(data)}, addr)
+	}
+	write := func(offset uint32, push bool, data string) error {
+		return writeFrom(testAddr, offset, push, data)
+	}
+
+	// A huge offset is refused rather than allocated
+	if err := write(0xFFFFFF00, true, "{}"); !errors.Is(err, ErrJSONWrite) {
+		t.Errorf("Error = %v, expected ErrJSONWrite for a huge offset", err)
+	}
+
+	// A packet that skips ahead drops the write
+	write(0, false, `{"config":`)
+	if err := write(20, true, `{"ip":"10.0.0.2"}}`); !errors.Is(err, ErrJSONWrite) {
+		t.Errorf("Error = %v, expected ErrJSONWrite for a gap", err)
+	}
+
+	// So does a document over the limit
+	chunk := strings.Repeat(" ", DDP_MAX_DATALEN)
+	var err error
+	for offset := 0; err == nil && offset <= MaxJSONSize; offset += len(chunk) {
+		err = write(uint32(offset), false, chunk)
+	}
+	if !errors.Is(err, ErrJSONWrite) {
+		t.Errorf("Error = %v, expected ErrJSONWrite past MaxJSONSize", err)
+	}
+
+	// A write whose sender stalls expires
+	writeFrom(otherAddr, 0, false, `{"config":`)
+	time.Sleep(40 * time.Millisecond)
+	write(0, false, `{"config":`)
+	store.writes.mu.Lock()
+	pending := len(store.writes.pending)
+	store.writes.mu.Unlock()
+	if pending != 1 {
+		t.Errorf("%d pending writes, expected 1", pending)
+	}
+	if err := writeFrom(otherAddr, 10, true, `{"gw":"10.0.0.1"}}`); !errors.Is(err, ErrJSONWrite) {
+		t.Errorf("Error = %v, expected ErrJSONWrite for an expired write", err)
+	}
+	if err := write(10, true, `{"ip":"10.0.0.2"}}`); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	var ip string
+	if found, _ := store.Get("ip", &ip); !found || ip != "10.0.0.2" {
+		t.Errorf("ip = %q, expected 10.0.0.2", ip)
+	}
+}
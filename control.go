@@ -0,0 +1,248 @@
+package ddp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+)
+
+// ErrPowerNotAlone is returned for CONTROL writes that set power along with other settings
+var ErrPowerNotAlone = errors.New("power must be sent alone")
+
+// EffectCommand is the effect part of a CONTROL write.
+// Settings that weren't written are nil, or empty for Effect and Colors.
+type EffectCommand struct {
+	Effect    string
+	Intensity *int // 0-100
+	Speed     *int // 1-100
+	Direction *int // normal=0 or reverse=1
+	Colors    []ControlColor
+}
+
+// ControlDispatcher handles CONTROL writes on DDP_ID_CONTROL, see RegisterControlDispatcher.
+// Each write is checked and then passed to the callbacks for the parts it contains,
+// effect settings first, then favorites, then save.
+type ControlDispatcher struct {
+	mu          sync.Mutex
+	favorites   []Favorite
+	onEffect    func(EffectCommand) error
+	onPower     func(on bool) error
+	onFavorites func([]Favorite) error
+	onSave      func() error
+
+	writes jsonAssembler
+}
+
+// NewControlDispatcher returns a dispatcher with no callbacks and no favorites
+func NewControlDispatcher() *ControlDispatcher {
+	return &ControlDispatcher{}
+}
+
+// OnEffect sets the callback for writes of fx, int, spd, dir or colors
+func (d *ControlDispatcher) OnEffect(fn func(EffectCommand) error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.onEffect = fn
+}
+
+// OnPower sets the callback for writes of power
+func (d *ControlDispatcher) OnPower(fn func(on bool) error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.onPower = fn
+}
+
+// OnFavorites sets the callback for writes of favorites. It gets the whole list
+// after the written entries have replaced those with the same index.
+func (d *ControlDispatcher) OnFavorites(fn func([]Favorite) error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.onFavorites = fn
+}
+
+// OnSave sets the callback for writes of save
+func (d *ControlDispatcher) OnSave(fn func() error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.onSave = fn
+}
+
+// SetFavorites replaces the favorites list served on a Query
+func (d *ControlDispatcher) SetFavorites(favorites []Favorite) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.favorites = append([]Favorite(nil), favorites...)
+}
+
+// Favorites returns the current favorites list
+func (d *ControlDispatcher) Favorites() []Favorite {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]Favorite(nil), d.favorites...)
+}
+
+// Document returns the favorites list as served on a Query, {"control":{"favorites":[...]}}
+func (d *ControlDispatcher) Document() ([]byte, error) {
+	return json.Marshal(controlDocument{Control: Control{Favorites: d.Favorites()}})
+}
+
+// Dispatch checks a {"control":{...}} write and passes it to the callbacks
+func (d *ControlDispatcher) Dispatch(data []byte) error {
+	var fields struct {
+		Control map[string]json.RawMessage `json:"control"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("invalid control write: %w", err)
+	}
+	if fields.Control == nil {
+		return errors.New(`control write has no "control" object`)
+	}
+
+	var doc controlDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("invalid control write: %w", err)
+	}
+	control := &doc.Control
+
+	if _, exists := fields.Control["power"]; exists && len(fields.Control) > 1 {
+		return ErrPowerNotAlone
+	}
+	if err := checkControl(control); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	onEffect, onPower, onFavorites, onSave := d.onEffect, d.onPower, d.onFavorites, d.onSave
+	d.mu.Unlock()
+
+	if control.Power != nil {
+		if onPower != nil {
+			return onPower(*control.Power == 1)
+		}
+		return nil
+	}
+
+	if control.Effect != "" || control.Intensity != nil || control.Speed != nil ||
+		control.Direction != nil || len(control.Colors) > 0 {
+		if onEffect != nil {
+			err := onEffect(EffectCommand{
+				Effect:    control.Effect,
+				Intensity: control.Intensity,
+				Speed:     control.Speed,
+				Direction: control.Direction,
+				Colors:    control.Colors,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(control.Favorites) > 0 {
+		favorites := d.mergeFavorites(control.Favorites)
+		if onFavorites != nil {
+			if err := onFavorites(favorites); err != nil {
+				return err
+			}
+		}
+	}
+
+	if control.Save == 1 && onSave != nil {
+		return onSave()
+	}
+	return nil
+}
+
+// mergeFavorites replaces the favorites with the same index as the written ones,
+// returning the new list sorted by index
+func (d *ControlDispatcher) mergeFavorites(written []Favorite) []Favorite {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	byIndex := make(map[int]Favorite, len(d.favorites)+len(written))
+	for _, f := range d.favorites {
+		byIndex[f.Index] = f
+	}
+	for _, f := range written {
+		byIndex[f.Index] = f
+	}
+
+	d.favorites = d.favorites[:0]
+	for _, f := range byIndex {
+		d.favorites = append(d.favorites, f)
+	}
+	sort.Slice(d.favorites, func(i, j int) bool {
+		return d.favorites[i].Index < d.favorites[j].Index
+	})
+	return append([]Favorite(nil), d.favorites...)
+}
+
+// checkControl checks the values of a CONTROL write are in the ranges the spec gives
+func checkControl(control *Control) error {
+	if control.Power != nil && *control.Power != 0 && *control.Power != 1 {
+		return fmt.Errorf("power %d is not 0 or 1", *control.Power)
+	}
+	if control.Save != 0 && control.Save != 1 {
+		return fmt.Errorf("save %d is not 0 or 1", control.Save)
+	}
+	if err := checkEffectSettings(control.Intensity, control.Speed, control.Direction, control.Colors); err != nil {
+		return err
+	}
+
+	for _, f := range control.Favorites {
+		if f.Index < 1 || f.Index > 10 {
+			return fmt.Errorf("favorite index %d is not 1-10", f.Index)
+		}
+		if f.Time != nil && *f.Time < 0 {
+			return fmt.Errorf("favorite %d time %d is negative", f.Index, *f.Time)
+		}
+		if err := checkEffectSettings(f.Intensity, f.Speed, f.Direction, f.Colors); err != nil {
+			return fmt.Errorf("favorite %d: %w", f.Index, err)
+		}
+	}
+	return nil
+}
+
+// checkEffectSettings checks the settings shared by effects and favorites
+func checkEffectSettings(intensity, speed, direction *int, colors []ControlColor) error {
+	if intensity != nil && (*intensity < 0 || *intensity > 100) {
+		return fmt.Errorf("intensity %d is not 0-100", *intensity)
+	}
+	if speed != nil && (*speed < 1 || *speed > 100) {
+		return fmt.Errorf("speed %d is not 1-100", *speed)
+	}
+	if direction != nil && *direction != 0 && *direction != 1 {
+		return fmt.Errorf("direction %d is not 0 or 1", *direction)
+	}
+	if len(colors) > 3 {
+		return fmt.Errorf("%d colors, at most 3 can be set", len(colors))
+	}
+	return nil
+}
+
+// handlePacket collects the packets of a CONTROL write and dispatches it on Push
+func (d *ControlDispatcher) handlePacket(packet *DDPPacket, addr *net.UDPAddr) error {
+	data, complete, err := d.writes.add(packet, addr)
+	if err != nil || !complete {
+		return err
+	}
+	return d.Dispatch(data)
+}
+
+// RegisterControlDispatcher serves dispatcher on DDP_ID_CONTROL: writes go to its
+// callbacks once their Push arrives and Queries read the favorites list.
+// Writes are limited as for RegisterConfigStore.
+// Use DispatchOrdered so the packets of a write are handled in order.
+func (s *DDPServer) RegisterControlDispatcher(dispatcher *ControlDispatcher) {
+	s.RegisterDocument(DDP_ID_CONTROL, dispatcher.Document)
+	s.RegisterHandler(DDP_ID_CONTROL, dispatcher.handlePacket)
+}
@@ -0,0 +1,113 @@
+package ddp
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// Test writes are routed to the callbacks for the parts they contain
+func TestControlDispatch(t *testing.T) {
+	d := NewControlDispatcher()
+
+	var effect *EffectCommand
+	var power []bool
+	saved := false
+	d.OnEffect(func(cmd EffectCommand) error { effect = &cmd; return nil })
+	d.OnPower(func(on bool) error { power = append(power, on); return nil })
+	d.OnSave(func() error { saved = true; return nil })
+
+	if err := d.Dispatch([]byte(`{"control":{"fx":"rainbow","spd":50,"colors":[{"r":255,"g":0,"b":0}],"save":1}}`)); err != nil {
+		t.Fatalf("Dispatch failed: %v", err)
+	}
+	if effect == nil || effect.Effect != "rainbow" || effect.Speed == nil || *effect.Speed != 50 ||
+		effect.Intensity != nil || len(effect.Colors) != 1 || effect.Colors[0].R != 255 {
+		t.Errorf("Effect = %+v, expected rainbow at speed 50 in red", effect)
+	}
+	if !saved {
+		t.Error("Save was not called")
+	}
+
+	d.Dispatch([]byte(`{"control":{"power":0}}`))
+	d.Dispatch([]byte(`{"control":{"power":1}}`))
+	if len(power) != 2 || power[0] || !power[1] {
+		t.Errorf("Power = %v, expected off then on", power)
+	}
+}
+
+// Test power can't be combined with other settings and values are range checked
+func TestControlChecks(t *testing.T) {
+	d := NewControlDispatcher()
+
+	called := false
+	d.OnEffect(func(cmd EffectCommand) error { called = true; return nil })
+	d.OnPower(func(on bool) error { called = true; return nil })
+
+	if err := d.Dispatch([]byte(`{"control":{"power":1,"fx":"rainbow"}}`)); !errors.Is(err, ErrPowerNotAlone) {
+		t.Errorf("Error = %v, expected ErrPowerNotAlone", err)
+	}
+
+	invalid := []string{
+		`{"control":{"int":101}}`,
+		`{"control":{"spd":0}}`,
+		`{"control":{"dir":2}}`,
+		`{"control":{"power":2}}`,
+		`{"control":{"colors":[{},{},{},{}]}}`,
+		`{"control":{"favorites":[{"i":11}]}}`,
+		`{"fx":"rainbow"}`,
+	}
+	for _, write := range invalid {
+		if err := d.Dispatch([]byte(write)); err == nil {
+			t.Errorf("Dispatch(%s) succeeded, expected an error", write)
+		}
+	}
+
+	if called {
+		t.Error("A callback was called for an invalid write")
+	}
+}
+
+// Test favorites writes replace entries by index and are served on a Query
+func TestControlFavorites(t *testing.T) {
+	d := NewControlDispatcher()
+	d.SetFavorites([]Favorite{{Index: 1, Effect: "fire"}, {Index: 3, Effect: "snow"}})
+
+	updates := make(chan []Favorite, 1)
+	d.OnFavorites(func(favorites []Favorite) error {
+		updates <- favorites
+		return nil
+	})
+
+	server := NewDDPServer()
+	server.SetDispatchMode(DispatchOrdered)
+	server.RegisterControlDispatcher(d)
+	controller := newQueryServer(t, server)
+
+	written := Favorite{Index: 3, Effect: "rain", Time: IntValue(30)}
+	if err := controller.SendControl(Control{Favorites: []Favorite{{Index: 2, Effect: "twinkle"}, written}}); err != nil {
+		t.Fatalf("SendControl failed: %v", err)
+	}
+
+	select {
+	case favorites := <-updates:
+		expected := []string{"fire", "twinkle", "rain"}
+		if len(favorites) != len(expected) {
+			t.Fatalf("Favorites = %+v, expected %d", favorites, len(expected))
+		}
+		for i := range expected {
+			if favorites[i].Index != i+1 || favorites[i].Effect != expected[i] {
+				t.Errorf("Favorite %d = %+v, expected %s", i, favorites[i], expected[i])
+			}
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Favorites callback was not called")
+	}
+
+	favorites, err := controller.GetFavorites()
+	if err != nil {
+		t.Fatalf("GetFavorites failed: %v", err)
+	}
+	if len(favorites) != 3 || favorites[2].Effect != "rain" || favorites[2].Time == nil || *favorites[2].Time != 30 {
+		t.Errorf("GetFavorites = %+v, expected the merged list", favorites)
+	}
+}
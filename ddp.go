@@ -4,12 +4,13 @@
 package ddp
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net"
+	"sync"
 	"time"
 )
 
@@ -18,6 +19,28 @@ const (
 	DDP_MAX_DATALEN = 480 * 3
 )
 
+// Well known IDs
+const (
+	DDP_ID_DISPLAY = 1
+	DDP_ID_CONTROL = 246
+	DDP_ID_CONFIG  = 250
+	DDP_ID_STATUS  = 251
+	DDP_ID_DMX     = 254
+	DDP_ID_ALL     = 255
+)
+
+// defaultQueryTimeout is how long a Query waits for the display to reply
+const defaultQueryTimeout = time.Second
+
+// DefaultShutdownTimeout is how long a server waits for handlers to finish when it stops
+const DefaultShutdownTimeout = 5 * time.Second
+
+// ErrQueryTimeout is returned when a display does not finish replying to a Query in time
+var ErrQueryTimeout = errors.New("timed out waiting for reply")
+
+// ErrShutdownTimeout is returned when handlers are still running after the shutdown timeout
+var ErrShutdownTimeout = errors.New("timed out waiting for handlers to finish")
+
 const (
 	flagVersionMask byte = 0xc0
 	flagVersion1    byte = 0x40
@@ -181,7 +204,7 @@ func NewDDPHeader(f1 ConfigFlag, f2 byte, dataType PixelDataType, id byte, offse
 // Returns the header and the number of bytes consumed (10 or 14)
 func ParseDDPHeader(data []byte) (*DDPHeader, int, error) {
 	if len(data) < 10 {
-		return nil, 0, errors.New("insufficient data for DDP header (need at least 10 bytes)")
+		return nil, 0, fmt.Errorf("%w: need at least 10 bytes, got %d", ErrShortHeader, len(data))
 	}
 
 	header := &DDPHeader{}
@@ -210,7 +233,7 @@ func ParseDDPHeader(data []byte) (*DDPHeader, int, error) {
 	// Parse timecode if present
 	if header.F1.Timecode {
 		if len(data) < 14 {
-			return nil, 0, errors.New("insufficient data for DDP header with timecode (need 14 bytes)")
+			return nil, 0, fmt.Errorf("%w: need 14 bytes with timecode, got %d", ErrShortHeader, len(data))
 		}
 		header.Timecode = binary.BigEndian.Uint32(data[10:14])
 		bytesConsumed = 14
@@ -219,60 +242,374 @@ func ParseDDPHeader(data []byte) (*DDPHeader, int, error) {
 	return header, bytesConsumed, nil
 }
 
-// DDPPacket represents a complete received DDP packet
+// DDPPacket represents a complete received DDP packet.
+// On the server Data points into a pooled receive buffer that is reused once the
+// handler returns, copy it to keep it any longer.
 type DDPPacket struct {
 	Header DDPHeader
 	Data   []byte
 }
 
-// DDPController connects to a pixel server and sends pixel data
+// DDPController connects to a pixel server and sends pixel data.
+// Writes and queries may be made from several goroutines at once.
 type DDPController struct {
-	header DDPHeader
-
-	output io.WriteCloser
-	server *net.PacketConn
+	headerLock   sync.Mutex // guards header, sequenceMode and the settings below it
+	header       DDPHeader
+	sequenceMode SequenceMode
+	queryTimeout time.Duration
+	copies       int           // times each packet is sent, see SetRedundancy
+	copySpacing  time.Duration // wait between copies
+
+	transport Transport
+
+	queryLock sync.Mutex // serializes queries, one outstanding at a time
+
+	replyLock  sync.Mutex
+	replyID    byte
+	replies    chan *DDPPacket // non-nil while a query is waiting for replies
+	dmxHandler DMXHandler      // receives DMX replies no query is waiting for
+	closed     chan struct{}   // closed when the reply reader stops
 }
 
 // DDPServer listens for DDP packets
 type DDPServer struct {
-	conn     *net.UDPConn
-	handlers map[byte]PacketHandler
-	running  bool
+	mu              sync.Mutex
+	transport       Transport
+	cancel          context.CancelFunc // stops the running Serve
+	stopped         chan struct{}      // closed once the running Serve stops reading
+	inflight        sync.WaitGroup     // handlers still running
+	queued          int32              // received packets not yet handled, see MaxQueuedPackets
+	shutdownTimeout time.Duration
+
+	handlers       map[byte]PacketHandler
+	ranges         []handlerRange
+	defaultHandler PacketHandler
+
+	frames    map[byte]*frameBuffer
+	documents map[byte]DocumentFunc
+	pushMode  PushMode
+	storage   StorageProvider
+
+	checkDataType   bool
+	dataTypeProfile DataTypeProfile
+	parseMode       ParseMode
+
+	errorHandler ErrorHandler
+
+	device       *DeviceInfo
+	statusDelay  bool
+	announceAddr *net.UDPAddr
+
+	timecode timecodeScheduler
+
+	dispatchMode DispatchMode
+	ordered      orderedDispatcher
+
+	sequences sequenceTracker
 }
 
-// PacketHandler is called when a packet is received for a specific ID
+// PacketHandler is called when a packet is received for a specific ID.
+// The packet and its Data are only valid until the handler returns.
 type PacketHandler func(packet *DDPPacket, addr *net.UDPAddr) error
 
+// WriteOffset writes pixel data starting at offset in the display's frame buffer
 func (c *DDPController) WriteOffset(data []byte, offset uint32) (int, error) {
-	c.header.Offset = offset
-	return c.Write(append(c.header.Bytes(), data...))
+	c.SetOffset(offset)
+	return c.Write(data)
 }
 
 // Writes pixel data to the DDP server, without offset
 func (c *DDPController) Write(data []byte) (int, error) {
+	return c.WriteContext(context.Background(), data)
+}
 
+// WriteContext is Write, giving up if ctx is done before the packet is sent
+func (c *DDPController) WriteContext(ctx context.Context, data []byte) (int, error) {
+	return c.writePacket(ctx, c.currentHeader(), data)
+}
+
+// WriteFrame writes a complete frame of pixel data, splitting it into packets of
+// at most DDP_MAX_DATALEN bytes with increasing offsets starting at 0.
+// Only the last packet has the Push flag set, so the display shows the frame once
+// all of it has arrived. An empty frame sends a single Push with no data.
+// Returns the number of frame bytes written.
+func (c *DDPController) WriteFrame(frame []byte) (int, error) {
+	return c.WriteFrameContext(context.Background(), frame)
+}
+
+// WriteFrameContext is WriteFrame, stopping before the next packet if ctx is done.
+// The display keeps the packets already sent but doesn't show them without the Push.
+func (c *DDPController) WriteFrameContext(ctx context.Context, frame []byte) (int, error) {
+	return c.writeChunks(ctx, c.currentHeader(), frame, true)
+}
+
+// writeChunks writes data using h, split into packets with increasing offsets
+// starting at 0. If push is set, the last packet has the Push flag and no other does.
+func (c *DDPController) writeChunks(ctx context.Context, h DDPHeader, data []byte, push bool) (int, error) {
+	written := 0
+
+	c.headerLock.Lock()
+	perPacket := c.sequenceMode == SequencePerPacket
+	c.headerLock.Unlock()
+
+	h.SequenceNumber = c.nextSequence()
+	for {
+		chunk := data[written:]
+		last := len(chunk) <= DDP_MAX_DATALEN
+		if !last {
+			chunk = chunk[:DDP_MAX_DATALEN]
+		}
+
+		if written > 0 && perPacket {
+			h.SequenceNumber = c.nextSequence()
+		}
+		h.Offset = uint32(written)
+		h.F1.Push = push && last
+		if _, err := c.sendData(ctx, h, chunk); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+
+		if last {
+			return written, nil
+		}
+	}
+}
+
+// writePacket sends a single packet using h, stamped with the next sequence
+// number and the length of data
+func (c *DDPController) writePacket(ctx context.Context, h DDPHeader, data []byte) (int, error) {
+	h.SequenceNumber = c.nextSequence()
+	return c.sendData(ctx, h, data)
+}
+
+// sendData sends a single packet using h, stamped with the length of data
+func (c *DDPController) sendData(ctx context.Context, h DDPHeader, data []byte) (int, error) {
 	if len(data) > DDP_MAX_DATALEN {
 		return 0, fmt.Errorf("data length %d exceeds maximum of %d", len(data), DDP_MAX_DATALEN)
 	}
 
-	// Iterate on sequence number
-	if c.header.SequenceNumber != 0x00 {
-		if c.header.SequenceNumber > 15 {
-			c.header.SequenceNumber = 1
-		} else {
-			c.header.SequenceNumber++
+	h.Length = uint16(len(data))
+	return c.sendPacket(ctx, h, data)
+}
+
+// sendPacket sends h followed by data
+func (c *DDPController) sendPacket(ctx context.Context, h DDPHeader, data []byte) (int, error) {
+	if c.transport == nil {
+		return 0, errors.New("controller is not connected")
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	// Transports that can block on write (e.g. TCP) honour the ctx deadline
+	if conn, ok := c.transport.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		deadline, _ := ctx.Deadline()
+		conn.SetWriteDeadline(deadline)
+	}
+
+	packet := append(h.Bytes(), data...)
+	if err := c.transport.WritePacket(packet, nil); err != nil {
+		return 0, err
+	}
+
+	// Copies keep the sequence number so receivers can drop them
+	if !h.F1.Query {
+		c.headerLock.Lock()
+		copies, spacing := c.copies, c.copySpacing
+		c.headerLock.Unlock()
+
+		for i := 1; i < copies; i++ {
+			if err := sleepContext(ctx, spacing); err != nil {
+				return len(packet), err
+			}
+			if err := c.transport.WritePacket(packet, nil); err != nil {
+				return len(packet), err
+			}
+		}
+	}
+	return len(packet), nil
+}
+
+// SetRedundancy sends every packet n times in a row with the same header and
+// sequence number, waiting spacing between copies, so receivers that drop
+// back-to-back duplicates see each packet once even if some are lost.
+// Queries are sent once. n of 1 or less turns redundancy off.
+//
+// Receivers only drop copies with a sequence number, so n over 1 turns sequencing
+// on (see EnableSequence). Turning sequencing off again sends copies that
+// receivers handle as separate packets.
+func (c *DDPController) SetRedundancy(n int, spacing time.Duration) {
+	c.headerLock.Lock()
+	defer c.headerLock.Unlock()
+
+	c.copies = n
+	c.copySpacing = spacing
+	if n > 1 && c.header.SequenceNumber == 0 {
+		// Start so that the next packet is 1
+		c.header.SequenceNumber = 15
+	}
+}
+
+// sleepContext waits for d, or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Query reads length bytes starting at offset from the given ID on the display.
+// The display answers with one or more Reply packets, the last one marked with
+// the Push flag; these are reassembled by offset and the data returned.
+// The reply may be shorter than length, or empty if the ID can't be read.
+// Returns ErrQueryTimeout if the display does not finish replying in time.
+func (c *DDPController) Query(id byte, offset uint32, length uint16) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout())
+	defer cancel()
+
+	data, err := c.QueryContext(ctx, id, offset, length)
+	return data, timeoutError(err)
+}
+
+// timeoutError reports the query timeout running out as ErrQueryTimeout
+func timeoutError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrQueryTimeout
+	}
+	return err
+}
+
+// QueryContext is Query, waiting for the reply until ctx is done instead of the query timeout
+func (c *DDPController) QueryContext(ctx context.Context, id byte, offset uint32, length uint16) ([]byte, error) {
+	c.queryLock.Lock()
+	defer c.queryLock.Unlock()
+
+	replies := make(chan *DDPPacket, 64)
+	c.replyLock.Lock()
+	c.replyID = id
+	c.replies = replies
+	c.replyLock.Unlock()
+
+	defer func() {
+		c.replyLock.Lock()
+		c.replies = nil
+		c.replyLock.Unlock()
+	}()
+
+	h := DDPHeader{
+		F1:     ConfigFlag{Query: true},
+		ID:     id,
+		Offset: offset,
+		Length: length,
+	}
+	h.SequenceNumber = c.nextSequence()
+	if _, err := c.sendPacket(ctx, h, nil); err != nil {
+		return nil, err
+	}
+
+	buf := replyBuffer{offset: offset}
+	for {
+		select {
+		case reply := <-replies:
+			if buf.add(reply) {
+				return buf.data, nil
+			}
+		case <-c.closed:
+			return nil, net.ErrClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
 		}
 	}
+}
 
-	c.header.Length = uint16(len(data))
-	return c.output.Write(append(c.header.Bytes(), data...))
+// replyBuffer reassembles the Reply packets answering a query starting at offset.
+// Replies can arrive out of order, so it is complete once the Push reply has
+// arrived and everything before it has been received.
+type replyBuffer struct {
+	offset   uint32
+	data     []byte
+	received map[uint32]int // length of each reply by offset
+	total    int
+	pushEnd  int // end of the Push reply relative to offset, -1 until it arrives
 }
 
+// add places the reply's data at its offset, returns true once the reply is complete
+func (b *replyBuffer) add(reply *DDPPacket) bool {
+	if b.received == nil {
+		b.received = make(map[uint32]int)
+		b.pushEnd = -1
+	}
+
+	if reply.Header.Offset >= b.offset {
+		start := int(reply.Header.Offset - b.offset)
+		end := start + len(reply.Data)
+		if end > len(b.data) {
+			b.data = append(b.data, make([]byte, end-len(b.data))...)
+		}
+		copy(b.data[start:end], reply.Data)
+
+		if _, seen := b.received[reply.Header.Offset]; !seen {
+			b.received[reply.Header.Offset] = len(reply.Data)
+			b.total += len(reply.Data)
+		}
+		if reply.Header.F1.Push {
+			b.pushEnd = end
+		}
+	} else if reply.Header.F1.Push {
+		// An empty reply at offset 0 means the ID can't be read
+		b.pushEnd = 0
+	}
+
+	return b.pushEnd >= 0 && b.total >= b.pushEnd
+}
+
+// SetQueryTimeout sets how long Query waits for the display to finish replying
+func (c *DDPController) SetQueryTimeout(timeout time.Duration) {
+	c.headerLock.Lock()
+	defer c.headerLock.Unlock()
+
+	c.queryTimeout = timeout
+}
+
+// timeout returns the query timeout
+func (c *DDPController) timeout() time.Duration {
+	c.headerLock.Lock()
+	defer c.headerLock.Unlock()
+
+	return c.queryTimeout
+}
+
+// SetDefaultHeader sets the header used for writes. Its sequence number is where
+// sequencing continues from, 0 turns sequencing off (see EnableSequence).
 func (c *DDPController) SetDefaultHeader(h DDPHeader) {
+	c.headerLock.Lock()
+	defer c.headerLock.Unlock()
+
 	c.header = h
 }
 
+// currentHeader returns a copy of the header used for writes
+func (c *DDPController) currentHeader() DDPHeader {
+	c.headerLock.Lock()
+	defer c.headerLock.Unlock()
+
+	return c.header
+}
+
 func (c *DDPController) SetOffset(offset uint32) {
+	c.headerLock.Lock()
+	defer c.headerLock.Unlock()
+
 	c.header.Offset = offset
 }
 
@@ -290,7 +627,9 @@ func (c *DDPController) SetID(id uint8) error {
 		return errors.New("ID 0 is reserved")
 	}
 
+	c.headerLock.Lock()
 	c.header.ID = byte(id)
+	c.headerLock.Unlock()
 
 	return nil
 }
@@ -298,12 +637,18 @@ func (c *DDPController) SetID(id uint8) error {
 // SetTimecode enables timecode and sets the value
 // The timecode is the 32 middle bits of 64-bit NTP time
 func (c *DDPController) SetTimecode(timecode uint32) {
+	c.headerLock.Lock()
+	defer c.headerLock.Unlock()
+
 	c.header.F1.Timecode = true
 	c.header.Timecode = timecode
 }
 
 // DisableTimecode disables timecode support
 func (c *DDPController) DisableTimecode() {
+	c.headerLock.Lock()
+	defer c.headerLock.Unlock()
+
 	c.header.F1.Timecode = false
 	c.header.Timecode = 0
 }
@@ -330,17 +675,45 @@ func TimeToNTPTimecode(t time.Time) uint32 {
 	return uint32((ntpTime >> 16) & 0xFFFFFFFF)
 }
 
+// NTPTimecodeToTime converts a 32-bit NTP timecode back to a time.Time.
+// The timecode only carries 16 bits of seconds (about 18 hours), so the result
+// is the matching time closest to ref, normally the time the packet was received.
+func NTPTimecodeToTime(timecode uint32, ref time.Time) time.Time {
+	const ntpEpochOffset = 2208988800
+
+	refSecs := ref.Unix() + ntpEpochOffset
+
+	// Take the upper seconds bits from ref and pick the nearest wrap
+	secs := (refSecs &^ 0xFFFF) | int64(timecode>>16)
+	if diff := secs - refSecs; diff > 0x8000 {
+		secs -= 0x10000
+	} else if diff < -0x8000 {
+		secs += 0x10000
+	}
+
+	// 16 bits of fraction in units of 2^-16 seconds
+	nanos := (int64(timecode&0xFFFF) * 1000000000) >> 16
+
+	return time.Unix(secs-ntpEpochOffset, nanos)
+}
+
 // NTPTimecodeFromDuration creates an NTP timecode from a duration relative to now
 func NTPTimecodeFromDuration(d time.Duration) uint32 {
 	return TimeToNTPTimecode(time.Now().Add(d))
 }
 
+// DefaultDDPHeader returns the header used by new controllers: 8-bit RGB to the
+// display ID with Push set. SSS is bits per element, so this is 3 bytes per pixel.
 func DefaultDDPHeader() DDPHeader {
-	return NewDDPHeader(NewConfigFlag(false, false, false, false, true), 0x01, PixelDataType{RGB, Pixel24Bits, false}, 0x01, 0, 132)
+	return NewDDPHeader(NewConfigFlag(false, false, false, false, true), 0x01, PixelDataType{RGB, Pixel8Bits, false}, 0x01, 0, 132)
 }
 
 func NewDDPController() *DDPController {
-	return &DDPController{header: DefaultDDPHeader()}
+	return &DDPController{
+		header:       DefaultDDPHeader(),
+		queryTimeout: defaultQueryTimeout,
+		closed:       make(chan struct{}),
+	}
 }
 
 func (d *DDPController) ConnectUDP(addrString string) error {
@@ -357,79 +730,137 @@ func (d *DDPController) ConnectUDP(addrString string) error {
 		return err
 	}
 
-	d.output = conn
+	d.Connect(NewUDPTransport(conn))
+
+	return nil
 
-	// Listen for UDP packets on any available port (for receiving replies)
-	// Use port 0 to let the OS assign an available port
-	udpServer, err := net.ListenPacket("udp", ":0")
+}
+
+// ConnectTCP connects to a display over TCP, for links where reliability matters more than latency
+func (d *DDPController) ConnectTCP(addrString string) error {
+	conn, err := net.Dial("tcp", addrString)
 	if err != nil {
-		// If listening fails, just log and continue without reply support
-		log.Printf("Warning: could not start listener for replies: %v", err)
-		return nil
+		return err
 	}
 
-	d.server = &udpServer
-
-	go d.handlePackets()
+	d.Connect(NewStreamTransport(conn))
 
 	return nil
+}
 
+// Connect sends packets to the display over t, which must write to its peer when
+// no address is given. The controller takes ownership of t and closes it on Close.
+func (d *DDPController) Connect(t Transport) {
+	d.transport = t
+
+	// Replies come back from the display over the same transport we send on
+	d.closed = make(chan struct{})
+	go d.handlePackets(t, d.closed)
 }
 
 func (d *DDPController) Close() error {
-	if d.output != nil {
-		d.output.Close()
-	}
-	if d.server != nil {
-		return (*d.server).Close()
+	if d.transport != nil {
+		return d.transport.Close()
 	}
 	return nil
 }
 
-func (d *DDPController) handlePackets() {
-	buf := make([]byte, 65507)
+// handlePackets reads Reply packets from the display and hands them to a waiting Query
+func (d *DDPController) handlePackets(t Transport, closed chan struct{}) {
+	defer close(closed)
+
+	buf := make([]byte, maxPacketSize)
 	for {
-		_, _, err := (*d.server).ReadFrom(buf)
+		n, addr, err := t.ReadPacket(buf)
 		if err != nil {
-			// Ignore closed network connection errors (happens during Close())
-			if !isClosedError(err) {
-				log.Print(err)
+			// Stop once the connection is closed (happens during Close())
+			if isClosedError(err) {
+				return
 			}
-			return
+			// Anything else (e.g. ICMP port unreachable from a previous send) is transient
+			continue
 		}
 
-		//fmt.Println("Received ", n, " bytes from ", addr)
-		//fmt.Println(buf[0:n], (len(buf[0:n])-10)/3)
+		header, headerSize, err := ParseDDPHeader(buf[:n])
+		if err != nil || !header.F1.Reply {
+			continue
+		}
+
+		end := headerSize + int(header.Length)
+		if end > n {
+			end = n
+		}
+		data := make([]byte, end-headerSize)
+		copy(data, buf[headerSize:end])
+
+		packet := &DDPPacket{Header: *header, Data: data}
+		if !d.deliverReply(packet) && header.ID == DDP_ID_DMX {
+			d.handleDMX(packet, toUDPAddr(addr))
+		}
 	}
 }
 
+// deliverReply passes a reply to the outstanding query for its ID, if any.
+// Returns false if no query is waiting for it.
+func (d *DDPController) deliverReply(packet *DDPPacket) bool {
+	d.replyLock.Lock()
+	defer d.replyLock.Unlock()
+
+	if d.replies == nil || packet.Header.ID != d.replyID {
+		return false
+	}
+
+	select {
+	case d.replies <- packet:
+	default:
+		// Query is not keeping up, drop rather than block the reader
+	}
+	return true
+}
+
 // isClosedError checks if an error is due to a closed connection
 func isClosedError(err error) bool {
-	return err != nil && (err.Error() == "use of closed network connection" ||
-		err.Error() == "EOF")
+	return errors.Is(err, net.ErrClosed) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
 }
 
 // NewDDPServer creates a new DDP server
 func NewDDPServer() *DDPServer {
 	return &DDPServer{
-		handlers: make(map[byte]PacketHandler),
-		running:  false,
+		handlers:        make(map[byte]PacketHandler),
+		frames:          make(map[byte]*frameBuffer),
+		documents:       make(map[byte]DocumentFunc),
+		shutdownTimeout: DefaultShutdownTimeout,
 	}
 }
 
-// RegisterHandler registers a handler for packets with a specific ID
+// RegisterHandler registers a handler for packets with a specific ID.
+// A handler for DDP_ID_ALL receives "all devices" packets instead of them being
+// delivered to every display ID, see handleAll.
 func (s *DDPServer) RegisterHandler(id byte, handler PacketHandler) {
 	s.handlers[id] = handler
 }
 
-// RegisterDefaultHandler registers a handler for all unhandled IDs
+// RegisterDefaultHandler registers a handler for all IDs with no handler of their own.
+// It isn't given Queries, those get the empty Reply for unreadable IDs instead.
 func (s *DDPServer) RegisterDefaultHandler(handler PacketHandler) {
-	s.handlers[0xFF] = handler // Use 0xFF as special "default" key internally
+	s.defaultHandler = handler
+}
+
+// SetShutdownTimeout sets how long Serve waits for running handlers once it stops
+func (s *DDPServer) SetShutdownTimeout(timeout time.Duration) {
+	s.shutdownTimeout = timeout
 }
 
 // Listen starts the server on the specified address
 // If addr is empty, listens on ":4048" (all interfaces, default DDP port)
 func (s *DDPServer) Listen(addr string) error {
+	return s.ListenAndServe(context.Background(), addr)
+}
+
+// ListenAndServe listens on the specified UDP address and serves packets until
+// ctx is cancelled or the server is closed, see Serve.
+// If addr is empty, listens on ":4048" (all interfaces, default DDP port)
+func (s *DDPServer) ListenAndServe(ctx context.Context, addr string) error {
 	if addr == "" {
 		addr = fmt.Sprintf(":%d", DDP_PORT)
 	}
@@ -444,87 +875,291 @@ func (s *DDPServer) Listen(addr string) error {
 		return fmt.Errorf("failed to listen on UDP: %w", err)
 	}
 
-	s.conn = conn
-	s.running = true
+	return s.Serve(ctx, conn)
+}
 
-	log.Printf("DDP server listening on %s", addr)
+// ListenAndServeTCP listens on the specified TCP address and serves packets from
+// every connection until ctx is cancelled or the server is closed, see Serve.
+// If addr is empty, listens on ":4048" (all interfaces, default DDP port)
+func (s *DDPServer) ListenAndServeTCP(ctx context.Context, addr string) error {
+	if addr == "" {
+		addr = fmt.Sprintf(":%d", DDP_PORT)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on TCP: %w", err)
+	}
 
-	return s.serve()
+	return s.ServeTransport(ctx, NewListenerTransport(listener))
 }
 
-// serve handles incoming packets
-func (s *DDPServer) serve() error {
-	buf := make([]byte, 65507) // Max UDP packet size
+// Serve reads packets from conn and dispatches them to handlers until ctx is
+// cancelled or the server is closed. It then closes conn and waits for running
+// handlers to finish, returning ErrShutdownTimeout if they take longer than the
+// shutdown timeout. Returns nil once stopped.
+func (s *DDPServer) Serve(ctx context.Context, conn net.PacketConn) error {
+	return s.ServeTransport(ctx, NewUDPTransport(conn))
+}
 
-	for s.running {
-		n, addr, err := s.conn.ReadFromUDP(buf)
+// ServeTransport is Serve for any Transport
+func (s *DDPServer) ServeTransport(ctx context.Context, t Transport) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s.mu.Lock()
+	if s.transport != nil {
+		s.mu.Unlock()
+		return errors.New("server is already serving")
+	}
+	stopped := make(chan struct{})
+	s.transport = t
+	s.cancel = cancel
+	s.stopped = stopped
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.transport = nil
+		s.cancel = nil
+		s.stopped = nil
+		s.mu.Unlock()
+	}()
+
+	// Closing the transport unblocks the read
+	go func() {
+		<-ctx.Done()
+		t.Close()
+	}()
+
+	s.holdFrames()
+	s.announce(t)
+
+	err := s.serve(ctx, t)
+	cancel()
+	s.releaseHeld()
+	close(stopped)
+
+	if waitErr := s.waitHandlers(s.shutdownTimeout); err == nil {
+		err = waitErr
+	}
+	return err
+}
+
+// Addr returns the address the server is listening on, or nil if it isn't serving
+func (s *DDPServer) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.transport == nil {
+		return nil
+	}
+	return s.transport.LocalAddr()
+}
+
+// serve handles incoming packets
+func (s *DDPServer) serve(ctx context.Context, t Transport) error {
+	for {
+		// Each packet gets its own buffer so the next read can't overwrite it
+		pb := getPacketBuffer()
+		n, addr, err := t.ReadPacket(pb.data[:])
 		if err != nil {
-			if !s.running {
+			pb.release()
+			if ctx.Err() != nil {
 				return nil // Server was closed
 			}
-			log.Printf("Error reading packet: %v", err)
+			if isClosedError(err) {
+				return err
+			}
+			s.reportError(fmt.Errorf("failed to read packet: %w", err))
 			continue
 		}
 
-		// Parse packet in a goroutine to avoid blocking
-		go s.handlePacket(buf[:n], addr)
+		// Sequence numbers are tracked in arrival order, before dispatch can reorder packets
+		udpAddr := toUDPAddr(addr)
+		if s.sequences.track(pb.data[:n], udpAddr) {
+			pb.release()
+			continue
+		}
+
+		s.dispatch(pb, n, udpAddr)
 	}
+}
 
-	return nil
+// waitHandlers waits up to timeout for running handlers to finish
+func (s *DDPServer) waitHandlers(timeout time.Duration) error {
+	done := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return nil
+	case <-timer.C:
+		return ErrShutdownTimeout
+	}
+}
+
+// toUDPAddr converts the source address of a packet for handlers
+func toUDPAddr(addr net.Addr) *net.UDPAddr {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a
+	case *net.TCPAddr:
+		return &net.UDPAddr{IP: a.IP, Port: a.Port, Zone: a.Zone}
+	}
+	if a, err := net.ResolveUDPAddr("udp", addr.String()); err == nil {
+		return a
+	}
+	return &net.UDPAddr{}
+}
+
+// handleBuffer processes the packet in pb and returns the buffer to the pool
+func (s *DDPServer) handleBuffer(pb *packetBuffer, n int, addr *net.UDPAddr) {
+	defer pb.release()
+	s.handlePacket(pb.data[:n], addr)
 }
 
 // handlePacket processes a single DDP packet
 func (s *DDPServer) handlePacket(data []byte, addr *net.UDPAddr) {
-	// Parse header
-	header, headerSize, err := ParseDDPHeader(data)
+	packet, warnings, err := ParseDDPPacket(data, s.parseMode)
 	if err != nil {
-		log.Printf("Failed to parse header from %s: %v", addr, err)
+		s.reportError(fmt.Errorf("packet from %s: %w", addr, err))
 		return
 	}
+	for _, w := range warnings {
+		s.reportError(fmt.Errorf("packet from %s: %w", addr, w))
+	}
+	header := &packet.Header
 
-	// Extract payload
-	payload := []byte{}
-	if len(data) > headerSize {
-		expectedPayloadSize := int(header.Length)
-		actualPayloadSize := len(data) - headerSize
+	if err := s.checkPixelLength(header); err != nil {
+		s.reportError(fmt.Errorf("packet for ID %d from %s: %w", header.ID, addr, err))
+		return
+	}
 
-		if actualPayloadSize < expectedPayloadSize {
-			log.Printf("Warning: payload size mismatch from %s (expected %d, got %d)",
-				addr, expectedPayloadSize, actualPayloadSize)
-			payload = data[headerSize:]
-		} else {
-			payload = data[headerSize : headerSize+expectedPayloadSize]
-		}
+	// Readable IDs answer queries themselves
+	if header.F1.Query && !header.F1.Reply && s.answerQuery(packet, addr) {
+		return
 	}
 
-	// Create packet
-	packet := &DDPPacket{
-		Header: *header,
-		Data:   payload,
+	// "All devices" packets go to every display ID
+	if header.ID == DDP_ID_ALL && !header.F1.Query && s.handleAll(packet, addr) {
+		return
+	}
+
+	s.route(packet, addr)
+}
+
+// route passes a packet to the frame buffer or handler for its ID
+func (s *DDPServer) route(packet *DDPPacket, addr *net.UDPAddr) {
+	header := &packet.Header
+
+	// IDs in display mode are assembled into their frame buffer
+	if fb, exists := s.frames[header.ID]; exists {
+		s.display(fb, packet)
+		return
 	}
 
 	// Find and call handler
-	handler, exists := s.handlers[header.ID]
-	if !exists {
-		// Try default handler
-		handler, exists = s.handlers[0xFF]
-		if !exists {
-			log.Printf("No handler for ID %d from %s", header.ID, addr)
-			return
-		}
+	handler := s.findHandler(header.ID)
+	if handler == nil {
+		s.reportError(fmt.Errorf("%w %d from %s", ErrNoHandler, header.ID, addr))
+		return
 	}
 
 	// Call handler
 	if err := handler(packet, addr); err != nil {
-		log.Printf("Handler error for ID %d from %s: %v", header.ID, addr, err)
+		s.reportError(&HandlerError{ID: header.ID, Addr: addr, Err: err})
+	}
+}
+
+// SendReply sends data read from id back to addr as Reply packets, split into
+// packets of at most DDP_MAX_DATALEN bytes with Push set on the last one.
+// Empty data sends a single empty Reply, which is how a display says the ID can't be read.
+func (s *DDPServer) SendReply(addr *net.UDPAddr, id byte, offset uint32, data []byte) error {
+	s.mu.Lock()
+	t := s.transport
+	s.mu.Unlock()
+
+	if t == nil {
+		return errors.New("server is not listening")
+	}
+
+	written := 0
+	for {
+		chunk := data[written:]
+		last := len(chunk) <= DDP_MAX_DATALEN
+		if !last {
+			chunk = chunk[:DDP_MAX_DATALEN]
+		}
+
+		h := DDPHeader{
+			F1:     ConfigFlag{Reply: true, Push: last},
+			ID:     id,
+			Offset: offset + uint32(written),
+			Length: uint16(len(chunk)),
+		}
+		if err := t.WritePacket(append(h.Bytes(), chunk...), addr); err != nil {
+			return err
+		}
+		written += len(chunk)
+
+		if last {
+			return nil
+		}
 	}
 }
 
-// Close stops the server
+// Shutdown stops the server like Close, then waits for running handlers to
+// finish or ctx to be done, whichever comes first
+func (s *DDPServer) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	stopped := s.stopped
+	s.mu.Unlock()
+
+	err := s.Close()
+
+	// No handler can start once the read loop has stopped
+	if stopped != nil {
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops the server, running handlers are left to finish in the background
 func (s *DDPServer) Close() error {
-	s.running = false
-	if s.conn != nil {
-		return s.conn.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Cancel first so Serve knows the read error that follows is a shutdown
+	if s.cancel != nil {
+		s.cancel()
+	}
+	if s.transport != nil {
+		if err := s.transport.Close(); !isClosedError(err) {
+			return err
+		}
 	}
 	return nil
 }
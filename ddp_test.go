@@ -2,7 +2,10 @@ package ddp
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"net"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -23,10 +26,28 @@ func (m *mockWriteCloser) Close() error {
 	return nil
 }
 
+// mockTransport sends packets to a mockWriteCloser, nothing is ever received
+type mockTransport struct {
+	*mockWriteCloser
+}
+
+func (m mockTransport) ReadPacket(buf []byte) (int, net.Addr, error) {
+	return 0, nil, net.ErrClosed
+}
+
+func (m mockTransport) WritePacket(packet []byte, addr net.Addr) error {
+	_, err := m.Write(packet)
+	return err
+}
+
+func (m mockTransport) LocalAddr() net.Addr {
+	return nil
+}
+
 func newMockController() (*DDPController, *mockWriteCloser) {
 	controller := NewDDPController()
 	mock := &mockWriteCloser{}
-	controller.output = mock
+	controller.transport = mockTransport{mock}
 	return controller, mock
 }
 
@@ -305,7 +326,7 @@ func TestDDPHeaderBytes(t *testing.T) {
 		{
 			name: "default header",
 			header: DefaultDDPHeader(),
-			expected: []byte{0x41, 0x01, 0x0D, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x84},
+			expected: []byte{0x41, 0x01, 0x0B, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x84},
 		},
 	}
 
@@ -371,16 +392,7 @@ func TestSequenceNumberWrapping(t *testing.T) {
 		t.Errorf("Sequence number = %d, expected 15", controller.header.SequenceNumber)
 	}
 
-	// Next write goes to 16 (BUG: should wrap at 15, not go to 16 first)
-	_, err = controller.Write(data)
-	if err != nil {
-		t.Fatalf("Write failed: %v", err)
-	}
-	if controller.header.SequenceNumber != 16 {
-		t.Errorf("Sequence number = %d, expected 16 (current buggy behavior)", controller.header.SequenceNumber)
-	}
-
-	// Third write wraps to 1
+	// Next write wraps to 1, 16 would set the reserved bits
 	_, err = controller.Write(data)
 	if err != nil {
 		t.Fatalf("Write failed: %v", err)
@@ -389,7 +401,7 @@ func TestSequenceNumberWrapping(t *testing.T) {
 		t.Errorf("Sequence number = %d, expected 1 (wrapped)", controller.header.SequenceNumber)
 	}
 
-	// Fourth write increments to 2
+	// Third write increments to 2
 	_, err = controller.Write(data)
 	if err != nil {
 		t.Fatalf("Write failed: %v", err)
@@ -721,8 +733,9 @@ func TestDefaultDDPHeader(t *testing.T) {
 		t.Errorf("Default data type = %v, expected RGB", header.DataType.DataType)
 	}
 
-	if header.DataType.DataSize != Pixel24Bits {
-		t.Errorf("Default pixel format = %v, expected Pixel24Bits", header.DataType.DataSize)
+	// SSS is bits per element, 8-bit RGB is 3 bytes per pixel
+	if header.DataType.DataSize != Pixel8Bits {
+		t.Errorf("Default pixel format = %v, expected Pixel8Bits", header.DataType.DataSize)
 	}
 
 	if header.ID != 1 {
@@ -1176,7 +1189,7 @@ func TestDDPServer(t *testing.T) {
 	defer server.Close()
 
 	// Get the actual port the server is listening on
-	serverAddr := server.conn.LocalAddr().String()
+	serverAddr := server.Addr().String()
 
 	// Create client and send packet
 	controller := NewDDPController()
@@ -1229,7 +1242,7 @@ func TestDDPServerDefaultHandler(t *testing.T) {
 	time.Sleep(50 * time.Millisecond)
 	defer server.Close()
 
-	serverAddr := server.conn.LocalAddr().String()
+	serverAddr := server.Addr().String()
 
 	// Send to an unregistered ID (should hit default handler)
 	controller := NewDDPController()
@@ -1287,7 +1300,7 @@ func TestDDPServerMultipleHandlers(t *testing.T) {
 	time.Sleep(50 * time.Millisecond)
 	defer server.Close()
 
-	serverAddr := server.conn.LocalAddr().String()
+	serverAddr := server.Addr().String()
 
 	// Send to ID 1
 	controller1 := NewDDPController()
@@ -1351,7 +1364,7 @@ func TestDDPServerTimecode(t *testing.T) {
 	time.Sleep(50 * time.Millisecond)
 	defer server.Close()
 
-	serverAddr := server.conn.LocalAddr().String()
+	serverAddr := server.Addr().String()
 
 	controller := NewDDPController()
 	err := controller.ConnectUDP(serverAddr)
@@ -1385,3 +1398,631 @@ func TestDDPServerTimecode(t *testing.T) {
 		t.Fatal("Timeout waiting for packet")
 	}
 }
+
+// splitPackets parses a stream of concatenated packets written to a mock
+func splitPackets(t *testing.T, data []byte) []*DDPPacket {
+	t.Helper()
+
+	var packets []*DDPPacket
+	for len(data) > 0 {
+		header, headerSize, err := ParseDDPHeader(data)
+		if err != nil {
+			t.Fatalf("Failed to parse packet: %v", err)
+		}
+		end := headerSize + int(header.Length)
+		if end > len(data) {
+			t.Fatalf("Packet length %d exceeds remaining %d bytes", header.Length, len(data)-headerSize)
+		}
+		packets = append(packets, &DDPPacket{Header: *header, Data: data[headerSize:end]})
+		data = data[end:]
+	}
+	return packets
+}
+
+// Test WriteOffset sends a single header
+func TestWriteOffsetSingleHeader(t *testing.T) {
+	controller, mock := newMockController()
+
+	data := []byte{1, 2, 3}
+	_, err := controller.WriteOffset(data, 30)
+	if err != nil {
+		t.Fatalf("WriteOffset failed: %v", err)
+	}
+
+	if len(mock.data) != 10+len(data) {
+		t.Fatalf("Total written = %d, expected %d", len(mock.data), 10+len(data))
+	}
+	if !bytes.Equal(mock.data[10:], data) {
+		t.Errorf("Payload = %v, expected %v", mock.data[10:], data)
+	}
+}
+
+// Test WriteFrame splits large frames into chunks
+func TestWriteFrame(t *testing.T) {
+	controller, mock := newMockController()
+
+	// 2000 RGB pixels
+	frame := make([]byte, 2000*3)
+	for i := range frame {
+		frame[i] = byte(i)
+	}
+
+	written, err := controller.WriteFrame(frame)
+	if err != nil {
+		t.Fatalf("WriteFrame failed: %v", err)
+	}
+	if written != len(frame) {
+		t.Errorf("Written = %d, expected %d", written, len(frame))
+	}
+
+	packets := splitPackets(t, mock.data)
+	expectedPackets := (len(frame) + DDP_MAX_DATALEN - 1) / DDP_MAX_DATALEN
+	if len(packets) != expectedPackets {
+		t.Fatalf("Packets = %d, expected %d", len(packets), expectedPackets)
+	}
+
+	reassembled := make([]byte, len(frame))
+	for i, p := range packets {
+		if int(p.Header.Offset) != i*DDP_MAX_DATALEN {
+			t.Errorf("Packet %d offset = %d, expected %d", i, p.Header.Offset, i*DDP_MAX_DATALEN)
+		}
+		if len(p.Data) > DDP_MAX_DATALEN {
+			t.Errorf("Packet %d length %d exceeds maximum", i, len(p.Data))
+		}
+		last := i == len(packets)-1
+		if p.Header.F1.Push != last {
+			t.Errorf("Packet %d push = %v, expected %v", i, p.Header.F1.Push, last)
+		}
+		copy(reassembled[p.Header.Offset:], p.Data)
+	}
+
+	if !bytes.Equal(reassembled, frame) {
+		t.Error("Reassembled frame does not match original")
+	}
+}
+
+// Test WriteFrame increments sequence numbers per packet
+func TestWriteFrameSequence(t *testing.T) {
+	controller, mock := newMockController()
+	controller.header.SequenceNumber = 1
+
+	_, err := controller.WriteFrame(make([]byte, DDP_MAX_DATALEN*3))
+	if err != nil {
+		t.Fatalf("WriteFrame failed: %v", err)
+	}
+
+	for i, p := range splitPackets(t, mock.data) {
+		if p.Header.SequenceNumber != byte(i+2) {
+			t.Errorf("Packet %d sequence = %d, expected %d", i, p.Header.SequenceNumber, i+2)
+		}
+	}
+}
+
+// Test WriteFrame with a frame that fits in one packet
+func TestWriteFrameSinglePacket(t *testing.T) {
+	controller, mock := newMockController()
+
+	frame := []byte{10, 20, 30}
+	_, err := controller.WriteFrame(frame)
+	if err != nil {
+		t.Fatalf("WriteFrame failed: %v", err)
+	}
+
+	packets := splitPackets(t, mock.data)
+	if len(packets) != 1 {
+		t.Fatalf("Packets = %d, expected 1", len(packets))
+	}
+	if !packets[0].Header.F1.Push {
+		t.Error("Single packet should have Push flag set")
+	}
+	if packets[0].Header.Offset != 0 {
+		t.Errorf("Offset = %d, expected 0", packets[0].Header.Offset)
+	}
+}
+
+// Test WriteFrame with an empty frame sends a bare Push
+func TestWriteFrameEmpty(t *testing.T) {
+	controller, mock := newMockController()
+
+	_, err := controller.WriteFrame(nil)
+	if err != nil {
+		t.Fatalf("WriteFrame failed: %v", err)
+	}
+
+	packets := splitPackets(t, mock.data)
+	if len(packets) != 1 {
+		t.Fatalf("Packets = %d, expected 1", len(packets))
+	}
+	if !packets[0].Header.F1.Push || packets[0].Header.Length != 0 {
+		t.Errorf("Expected zero-length Push, got push=%v length=%d", packets[0].Header.F1.Push, packets[0].Header.Length)
+	}
+}
+
+// Test WriteFrame leaves the controller's default header untouched
+func TestWriteFrameKeepsHeader(t *testing.T) {
+	controller, _ := newMockController()
+	controller.SetOffset(42)
+	controller.header.F1.Push = false
+
+	_, err := controller.WriteFrame(make([]byte, DDP_MAX_DATALEN+1))
+	if err != nil {
+		t.Fatalf("WriteFrame failed: %v", err)
+	}
+
+	if controller.header.Offset != 42 {
+		t.Errorf("Offset = %d, expected 42", controller.header.Offset)
+	}
+	if controller.header.F1.Push {
+		t.Error("Push flag should be unchanged")
+	}
+}
+
+// startFakeDisplay listens on a local UDP port and answers every Query with replies
+func startFakeDisplay(t *testing.T, reply func(query *DDPHeader) [][]byte) *net.UDPConn {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 65507)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			header, _, err := ParseDDPHeader(buf[:n])
+			if err != nil || !header.F1.Query {
+				continue
+			}
+			for _, packet := range reply(header) {
+				conn.WriteToUDP(packet, addr)
+			}
+		}
+	}()
+
+	return conn
+}
+
+// replyPacket builds a Reply packet for id at offset
+func replyPacket(id byte, offset uint32, data []byte, push bool) []byte {
+	h := DDPHeader{
+		F1:     ConfigFlag{Reply: true, Push: push},
+		ID:     id,
+		Offset: offset,
+		Length: uint16(len(data)),
+	}
+	return append(h.Bytes(), data...)
+}
+
+// Test Query reassembles multi-packet replies by offset
+func TestQuery(t *testing.T) {
+	queried := make(chan DDPHeader, 1)
+	display := startFakeDisplay(t, func(query *DDPHeader) [][]byte {
+		queried <- *query
+		return [][]byte{
+			replyPacket(query.ID, query.Offset+3, []byte{4, 5, 6}, false),
+			replyPacket(query.ID, query.Offset, []byte{1, 2, 3}, false),
+			replyPacket(query.ID, query.Offset+6, []byte{7}, true),
+		}
+	})
+
+	controller := NewDDPController()
+	if err := controller.ConnectUDP(display.LocalAddr().String()); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer controller.Close()
+
+	data, err := controller.Query(1, 100, 7)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	if !bytes.Equal(data, []byte{1, 2, 3, 4, 5, 6, 7}) {
+		t.Errorf("Data = %v, expected [1 2 3 4 5 6 7]", data)
+	}
+	query := <-queried
+	if !query.F1.Query || query.ID != 1 || query.Offset != 100 || query.Length != 7 {
+		t.Errorf("Unexpected query header: %+v", query)
+	}
+}
+
+// Test Query ignores packets that aren't replies for the queried ID
+func TestQueryIgnoresOtherPackets(t *testing.T) {
+	display := startFakeDisplay(t, func(query *DDPHeader) [][]byte {
+		notReply := DDPHeader{F1: ConfigFlag{Push: true}, ID: query.ID, Length: 1}
+		return [][]byte{
+			append(notReply.Bytes(), 9),
+			replyPacket(query.ID+1, 0, []byte{8}, true),
+			replyPacket(query.ID, 0, []byte{1}, true),
+		}
+	})
+
+	controller := NewDDPController()
+	if err := controller.ConnectUDP(display.LocalAddr().String()); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer controller.Close()
+
+	data, err := controller.Query(5, 0, 1)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if !bytes.Equal(data, []byte{1}) {
+		t.Errorf("Data = %v, expected [1]", data)
+	}
+}
+
+// Test Query with an unreadable ID returns no data
+func TestQueryNotReadable(t *testing.T) {
+	display := startFakeDisplay(t, func(query *DDPHeader) [][]byte {
+		return [][]byte{replyPacket(query.ID, 0, nil, true)}
+	})
+
+	controller := NewDDPController()
+	if err := controller.ConnectUDP(display.LocalAddr().String()); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer controller.Close()
+
+	data, err := controller.Query(1, 0, 100)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(data) != 0 {
+		t.Errorf("Data = %v, expected empty", data)
+	}
+}
+
+// Test Query times out when the display never pushes
+func TestQueryTimeout(t *testing.T) {
+	display := startFakeDisplay(t, func(query *DDPHeader) [][]byte {
+		return [][]byte{replyPacket(query.ID, 0, []byte{1}, false)}
+	})
+
+	controller := NewDDPController()
+	if err := controller.ConnectUDP(display.LocalAddr().String()); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer controller.Close()
+
+	controller.SetQueryTimeout(100 * time.Millisecond)
+
+	start := time.Now()
+	_, err := controller.Query(1, 0, 10)
+	if err != ErrQueryTimeout {
+		t.Fatalf("Error = %v, expected ErrQueryTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Query returned after %v, before the timeout", elapsed)
+	}
+}
+
+// Test Query without a connection
+func TestQueryNotConnected(t *testing.T) {
+	controller := NewDDPController()
+
+	_, err := controller.Query(1, 0, 10)
+	if err == nil {
+		t.Error("Query without a connection should fail")
+	}
+}
+
+// serveLocal serves on a local UDP port until ctx is done, Serve's result is sent on the channel
+func serveLocal(t *testing.T, ctx context.Context, server *DDPServer) (net.Addr, chan error) {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- server.Serve(ctx, conn)
+	}()
+
+	// Wait for Serve to take the connection
+	for server.Addr() == nil {
+		time.Sleep(time.Millisecond)
+	}
+
+	return conn.LocalAddr(), result
+}
+
+// Test Serve returns when its context is cancelled
+func TestServeContextCancel(t *testing.T) {
+	server := NewDDPServer()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, result := serveLocal(t, ctx, server)
+
+	cancel()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Errorf("Serve returned %v, expected nil", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Serve did not return after cancel")
+	}
+
+	if server.Addr() != nil {
+		t.Error("Addr should be nil once stopped")
+	}
+}
+
+// Test Serve waits for running handlers before returning
+func TestServeWaitsForHandlers(t *testing.T) {
+	server := NewDDPServer()
+
+	started := make(chan struct{})
+	finished := make(chan struct{})
+	server.RegisterHandler(1, func(packet *DDPPacket, addr *net.UDPAddr) error {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		close(finished)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	addr, result := serveLocal(t, ctx, server)
+
+	controller := NewDDPController()
+	if err := controller.ConnectUDP(addr.String()); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer controller.Close()
+	controller.Write([]byte{1, 2, 3})
+
+	<-started
+	cancel()
+
+	if err := <-result; err != nil {
+		t.Errorf("Serve returned %v, expected nil", err)
+	}
+
+	select {
+	case <-finished:
+	default:
+		t.Error("Serve returned before the handler finished")
+	}
+}
+
+// Test Serve gives up on slow handlers after the shutdown timeout
+func TestServeShutdownTimeout(t *testing.T) {
+	server := NewDDPServer()
+	server.SetShutdownTimeout(50 * time.Millisecond)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	server.RegisterHandler(1, func(packet *DDPPacket, addr *net.UDPAddr) error {
+		close(started)
+		<-release
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	addr, result := serveLocal(t, ctx, server)
+
+	controller := NewDDPController()
+	if err := controller.ConnectUDP(addr.String()); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer controller.Close()
+	controller.Write([]byte{1, 2, 3})
+
+	<-started
+	cancel()
+
+	select {
+	case err := <-result:
+		if err != ErrShutdownTimeout {
+			t.Errorf("Serve returned %v, expected ErrShutdownTimeout", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Serve did not return after the shutdown timeout")
+	}
+}
+
+// Test Shutdown stops the server and respects its context
+func TestShutdown(t *testing.T) {
+	server := NewDDPServer()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server.RegisterHandler(1, func(packet *DDPPacket, addr *net.UDPAddr) error {
+		close(started)
+		<-release
+		return nil
+	})
+
+	addr, result := serveLocal(t, context.Background(), server)
+
+	controller := NewDDPController()
+	if err := controller.ConnectUDP(addr.String()); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer controller.Close()
+	controller.Write([]byte{1, 2, 3})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Shutdown returned %v, expected context.DeadlineExceeded", err)
+	}
+
+	close(release)
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown returned %v, expected nil", err)
+	}
+	if err := <-result; err != nil {
+		t.Errorf("Serve returned %v, expected nil", err)
+	}
+}
+
+// Test QueryContext returns when its context is cancelled
+func TestQueryContextCancel(t *testing.T) {
+	display := startFakeDisplay(t, func(query *DDPHeader) [][]byte {
+		return nil
+	})
+
+	controller := NewDDPController()
+	if err := controller.ConnectUDP(display.LocalAddr().String()); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer controller.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	_, err := controller.QueryContext(ctx, 1, 0, 10)
+	if err != context.Canceled {
+		t.Errorf("Error = %v, expected context.Canceled", err)
+	}
+}
+
+// Test a pending Query returns when the controller is closed
+func TestQueryClosed(t *testing.T) {
+	display := startFakeDisplay(t, func(query *DDPHeader) [][]byte {
+		return nil
+	})
+
+	controller := NewDDPController()
+	if err := controller.ConnectUDP(display.LocalAddr().String()); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	time.AfterFunc(50*time.Millisecond, func() { controller.Close() })
+
+	_, err := controller.QueryContext(context.Background(), 1, 0, 10)
+	if !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Error = %v, expected net.ErrClosed", err)
+	}
+}
+
+// Test writes with a done context send nothing
+func TestWriteFrameContextDone(t *testing.T) {
+	controller, mock := newMockController()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	written, err := controller.WriteFrameContext(ctx, make([]byte, DDP_MAX_DATALEN*2))
+	if err != context.Canceled {
+		t.Errorf("Error = %v, expected context.Canceled", err)
+	}
+	if written != 0 || len(mock.data) != 0 {
+		t.Errorf("Written %d bytes, expected nothing", len(mock.data))
+	}
+}
+
+// Test redundant copies repeat the packet with the same sequence number
+func TestRedundancy(t *testing.T) {
+	controller, mock := newMockController()
+	controller.SetRedundancy(3, time.Millisecond)
+
+	if _, err := controller.WriteFrame(make([]byte, DDP_MAX_DATALEN+10)); err != nil {
+		t.Fatalf("WriteFrame failed: %v", err)
+	}
+
+	packets := splitPackets(t, mock.data)
+	if len(packets) != 6 {
+		t.Fatalf("Got %d packets, expected 6", len(packets))
+	}
+	for i := 0; i < 6; i += 3 {
+		for j := i + 1; j < i+3; j++ {
+			if packets[j].Header != packets[i].Header {
+				t.Errorf("Copy %d header = %+v, expected %+v", j, packets[j].Header, packets[i].Header)
+			}
+		}
+	}
+	if packets[0].Header.SequenceNumber == packets[3].Header.SequenceNumber {
+		t.Errorf("Both packets have sequence number %d, expected it to change between packets", packets[0].Header.SequenceNumber)
+	}
+
+	// Copies arrive as duplicates at a server
+	var tracker sequenceTracker
+	dropped := 0
+	for _, p := range packets {
+		if tracker.track(append(p.Header.Bytes(), p.Data...), testAddr) {
+			dropped++
+		}
+	}
+	if dropped != 4 {
+		t.Errorf("Server dropped %d copies, expected 4", dropped)
+	}
+}
+
+// Test redundancy turns sequencing on so the copies can be dropped
+func TestRedundancyEnablesSequence(t *testing.T) {
+	controller, mock := newMockController()
+	controller.DisableSequence()
+	controller.SetRedundancy(2, 0)
+
+	if _, err := controller.Write([]byte{1, 2, 3}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	packets := splitPackets(t, mock.data)
+	if len(packets) != 2 {
+		t.Fatalf("Got %d packets, expected 2", len(packets))
+	}
+	if packets[0].Header.SequenceNumber != 1 {
+		t.Errorf("Sequence number = %d, expected 1", packets[0].Header.SequenceNumber)
+	}
+
+	var tracker sequenceTracker
+	tracker.track(append(packets[0].Header.Bytes(), packets[0].Data...), testAddr)
+	if !tracker.track(append(packets[1].Header.Bytes(), packets[1].Data...), testAddr) {
+		t.Error("Copy was not dropped as a duplicate")
+	}
+}
+
+// Test no handler starts after Shutdown returns, even with packets still arriving
+func TestShutdownWaitsForReadLoop(t *testing.T) {
+	server := NewDDPServer()
+
+	var stopped int32
+	var late int32
+	server.RegisterHandler(1, func(packet *DDPPacket, addr *net.UDPAddr) error {
+		if atomic.LoadInt32(&stopped) != 0 {
+			atomic.AddInt32(&late, 1)
+		}
+		return nil
+	})
+
+	controllerEnd, serverEnd := NewMemoryTransportPair()
+	result := make(chan error, 1)
+	go func() {
+		result <- server.ServeTransport(context.Background(), serverEnd)
+	}()
+
+	packet := append((&DDPHeader{F1: ConfigFlag{Push: true}, ID: 1, Length: 1}).Bytes(), 1)
+	flooding := make(chan struct{})
+	go func() {
+		defer close(flooding)
+		for controllerEnd.WritePacket(packet, nil) == nil {
+		}
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown returned %v, expected nil", err)
+	}
+	atomic.StoreInt32(&stopped, 1)
+	controllerEnd.Close()
+	<-flooding
+	<-result
+
+	time.Sleep(10 * time.Millisecond)
+	if n := atomic.LoadInt32(&late); n != 0 {
+		t.Errorf("%d handlers ran after Shutdown returned", n)
+	}
+}
@@ -0,0 +1,167 @@
+package ddp
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// DeviceInfo describes the server as a display, served on DDP_ID_STATUS
+type DeviceInfo struct {
+	Manufacturer string
+	Model        string
+	Version      string
+	MAC          string // e.g. "00:11:22:33:44:55", its last byte sets the reply delay, see SetStatusDelay
+	Push         bool   // PUSH supported
+	NTP          bool   // NTP supported
+}
+
+// status returns the STATUS document for the device
+func (d *DeviceInfo) status() Status {
+	return Status{
+		Manufacturer: d.Manufacturer,
+		Model:        d.Model,
+		Version:      d.Version,
+		MAC:          d.MAC,
+		Push:         d.Push,
+		NTP:          d.NTP,
+	}
+}
+
+// statusRequest is the optional body of a STATUS query, naming the device that should answer
+type statusRequest struct {
+	MAC string `json:"mac"`
+}
+
+// SetDeviceInfo makes the server answer STATUS queries with info, so it can be found
+// by Discover. Queries naming another device with {"mac":...} aren't answered.
+// Stream transports such as TCP frame queries without a body, so there the
+// {"mac":...} request is not seen and every STATUS query is answered.
+func (s *DDPServer) SetDeviceInfo(info DeviceInfo) {
+	s.device = &info
+}
+
+// SetStatusDelay delays STATUS replies by the last byte of the MAC in milliseconds,
+// as the spec asks of replies to broadcast queries, to spread out the replies of
+// many displays. Off by default.
+//
+// The server can't tell broadcast and directed queries apart, so turning this on
+// delays directed queries too: every GetStatus waits up to 255ms, unless its query
+// names this device with {"mac":...}. The delay doesn't hold up other packets, and
+// replies still waiting when the server stops are not sent.
+func (s *DDPServer) SetStatusDelay(on bool) {
+	s.statusDelay = on
+}
+
+// SetAnnounce makes the server send its status to addr, usually a broadcast address,
+// when it starts serving, with {"update":"change","state":"up"} as the spec suggests
+// for power-up. The DDP port is used if addr has none. Needs SetDeviceInfo.
+func (s *DDPServer) SetAnnounce(addr string) error {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, fmt.Sprint(DDP_PORT))
+	}
+
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to resolve address: %w", err)
+	}
+
+	s.announceAddr = udpAddr
+	return nil
+}
+
+// answerStatus replies to a STATUS query with the device info
+func (s *DDPServer) answerStatus(packet *DDPPacket, addr *net.UDPAddr) {
+	var delay time.Duration
+	if s.statusDelay {
+		delay = macDelay(s.device.MAC)
+	}
+
+	var request statusRequest
+	if len(packet.Data) > 0 && json.Unmarshal(packet.Data, &request) == nil && request.MAC != "" {
+		if !sameMAC(request.MAC, s.device.MAC) {
+			return
+		}
+		// Only this device answers, no need to wait for others
+		delay = 0
+	}
+
+	data, err := json.Marshal(statusDocument{Status: s.device.status()})
+	if err != nil {
+		s.reportError(fmt.Errorf("status document: %w", err))
+		return
+	}
+
+	if delay == 0 {
+		s.sendReply(addr, DDP_ID_STATUS, 0, data)
+		return
+	}
+
+	// Wait in the background so later packets from the sender aren't held up.
+	// This runs inside a handler, so adding to inflight can't race Shutdown's Wait.
+	s.mu.Lock()
+	stopped := s.stopped
+	s.mu.Unlock()
+
+	s.inflight.Add(1)
+	go func() {
+		defer s.inflight.Done()
+
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+			s.sendReply(addr, DDP_ID_STATUS, 0, data)
+		case <-stopped:
+		}
+	}()
+}
+
+// announce sends the power-up status to the announce address
+func (s *DDPServer) announce(t Transport) {
+	if s.announceAddr == nil || s.device == nil {
+		return
+	}
+
+	status := s.device.status()
+	status.Update = "change"
+	status.State = "up"
+
+	data, err := json.Marshal(statusDocument{Status: status})
+	if err != nil {
+		s.reportError(fmt.Errorf("status document: %w", err))
+		return
+	}
+
+	h := DDPHeader{
+		F1:     ConfigFlag{Reply: true, Push: true},
+		ID:     DDP_ID_STATUS,
+		Length: uint16(len(data)),
+	}
+	if err := t.WritePacket(append(h.Bytes(), data...), s.announceAddr); err != nil {
+		s.reportError(fmt.Errorf("announce to %s: %w", s.announceAddr, err))
+	}
+}
+
+// normalizeMAC returns the hex digits of a MAC address in lower case
+func normalizeMAC(mac string) string {
+	return strings.ToLower(strings.NewReplacer(":", "", "-", "", ".", "").Replace(mac))
+}
+
+// sameMAC reports if two MAC addresses are the same, however they are written
+func sameMAC(a, b string) bool {
+	return normalizeMAC(a) == normalizeMAC(b)
+}
+
+// macDelay returns the last byte of mac in milliseconds, 0 if mac isn't valid
+func macDelay(mac string) time.Duration {
+	addr, err := hex.DecodeString(normalizeMAC(mac))
+	if err != nil || len(addr) < 6 {
+		return 0
+	}
+	return time.Duration(addr[len(addr)-1]) * time.Millisecond
+}
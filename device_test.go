@@ -0,0 +1,232 @@
+package ddp
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+)
+
+// Test a server with device info is found by Discover
+func TestDiscoverDeviceInfo(t *testing.T) {
+	server := NewDDPServer()
+	server.SetDeviceInfo(DeviceInfo{Manufacturer: "coral", Model: "ddp", MAC: "00:11:22:33:44:05", Push: true})
+	server.SetStatusDelay(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr, _ := serveLocal(t, ctx, server)
+
+	start := time.Now()
+	devices, err := Discover(context.Background(), addr.String(), 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	if len(devices) != 1 {
+		t.Fatalf("Found %d devices, expected 1", len(devices))
+	}
+
+	status := devices[0].Status
+	if status.Manufacturer != "coral" || status.Model != "ddp" || status.MAC != "00:11:22:33:44:05" || !status.Push {
+		t.Errorf("Status = %+v, expected the device info", status)
+	}
+	if time.Since(start) < 5*time.Millisecond {
+		t.Error("Reply was not delayed by the last byte of the MAC")
+	}
+}
+
+// Test STATUS queries naming a MAC are only answered by that device
+func TestStatusMACHint(t *testing.T) {
+	server := NewDDPServer()
+	server.SetDeviceInfo(DeviceInfo{Model: "ddp", MAC: "00:11:22:33:44:FF"})
+	server.SetStatusDelay(true)
+
+	controllerEnd, serverEnd := NewMemoryTransportPair()
+	serveTransport(t, server, serverEnd)
+
+	query := DDPHeader{F1: ConfigFlag{Query: true}, ID: DDP_ID_STATUS}
+	buf := make([]byte, maxPacketSize)
+
+	// Another device's MAC gets no reply, this one's gets one without the delay
+	controllerEnd.WritePacket(append(query.Bytes(), `{"mac":"00:11:22:33:44:00"}`...), nil)
+	controllerEnd.WritePacket(append(query.Bytes(), `{"mac":"00-11-22-33-44-ff"}`...), nil)
+
+	result := make(chan []byte, 2)
+	go func() {
+		for {
+			n, _, err := controllerEnd.ReadPacket(buf)
+			if err != nil {
+				return
+			}
+			result <- append([]byte(nil), buf[:n]...)
+		}
+	}()
+
+	select {
+	case packet := <-result:
+		header, size, err := ParseDDPHeader(packet)
+		if err != nil || !header.F1.Reply {
+			t.Fatalf("Got %v, expected a reply", packet)
+		}
+		var doc statusDocument
+		if err := json.Unmarshal(packet[size:], &doc); err != nil || doc.Status.Model != "ddp" {
+			t.Errorf("Reply = %s, expected the device status", packet[size:])
+		}
+	case <-time.After(200 * time.Millisecond):
+		t.Fatal("No reply to a query naming this device in time")
+	}
+
+	select {
+	case packet := <-result:
+		t.Errorf("Got a second reply %v, expected none for another device", packet)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// Test the server announces itself when it starts serving
+func TestAnnounce(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	server := NewDDPServer()
+	server.SetDeviceInfo(DeviceInfo{Model: "ddp"})
+	if err := server.SetAnnounce(listener.LocalAddr().String()); err != nil {
+		t.Fatalf("SetAnnounce failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	serveLocal(t, ctx, server)
+
+	listener.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, maxPacketSize)
+	n, _, err := listener.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("No announcement: %v", err)
+	}
+
+	header, size, err := ParseDDPHeader(buf[:n])
+	if err != nil || header.ID != DDP_ID_STATUS || !header.F1.Reply {
+		t.Fatalf("Announcement header = %+v, expected a STATUS reply", header)
+	}
+	var doc statusDocument
+	if err := json.Unmarshal(buf[size:n], &doc); err != nil {
+		t.Fatalf("Announcement is not JSON: %v", err)
+	}
+	if doc.Status.Update != "change" || doc.Status.State != "up" || doc.Status.Model != "ddp" {
+		t.Errorf("Announcement = %+v, expected update change, state up", doc.Status)
+	}
+}
+
+// Test the reply delay comes from the last byte of the MAC
+func TestMACDelay(t *testing.T) {
+	tests := map[string]time.Duration{
+		"00:11:22:33:44:55": 0x55 * time.Millisecond,
+		"00-11-22-33-44-FF": 255 * time.Millisecond,
+		"001122334400":      0,
+		"":                  0,
+		"not a mac":         0,
+	}
+
+	for mac, expected := range tests {
+		if delay := macDelay(mac); delay != expected {
+			t.Errorf("macDelay(%q) = %v, expected %v", mac, delay, expected)
+		}
+	}
+}
+
+// Test STATUS replies are prompt unless the delay is turned on
+func TestStatusNoDelayByDefault(t *testing.T) {
+	server := NewDDPServer()
+	server.SetDeviceInfo(DeviceInfo{Model: "ddp", MAC: "00:11:22:33:44:FF"})
+	controller := newQueryServer(t, server)
+
+	start := time.Now()
+	if _, err := controller.GetStatus(); err != nil {
+		t.Fatalf("GetStatus failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("GetStatus took %v, expected no MAC delay", elapsed)
+	}
+}
+
+// Test a STATUS query with a read length over TCP is answered and keeps the stream framed
+func TestStatusQueryTCP(t *testing.T) {
+	server := NewDDPServer()
+	server.SetDispatchMode(DispatchOrdered)
+	server.SetDeviceInfo(DeviceInfo{Model: "ddp", MAC: "00:11:22:33:44:55"})
+	server.RegisterJSON(1, func() interface{} { return "one" })
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	serveTransport(t, server, NewListenerTransport(listener))
+
+	controller := NewDDPController()
+	if err := controller.ConnectTCP(listener.Addr().String()); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer controller.Close()
+
+	data, err := controller.Query(DDP_ID_STATUS, 0, 100)
+	if err != nil {
+		t.Fatalf("STATUS query failed: %v", err)
+	}
+	var doc statusDocument
+	if err := json.Unmarshal(data, &doc); err != nil || doc.Status.Model != "ddp" {
+		t.Errorf("STATUS = %s, expected the device status", data)
+	}
+
+	data, err = controller.Query(1, 0, 5)
+	if err != nil {
+		t.Fatalf("Query after STATUS failed: %v", err)
+	}
+	if string(data) != `"one"` {
+		t.Errorf("Query = %s, expected \"one\"", data)
+	}
+}
+
+// Test a delayed STATUS reply holds up neither later packets nor Shutdown
+func TestStatusDelayShutdown(t *testing.T) {
+	server := NewDDPServer()
+	server.SetDispatchMode(DispatchOrdered)
+	server.SetDeviceInfo(DeviceInfo{Model: "ddp", MAC: "00:11:22:33:44:FF"})
+	server.SetStatusDelay(true)
+	server.RegisterJSON(1, func() interface{} { return "one" })
+
+	controllerEnd, serverEnd := NewMemoryTransportPair()
+	serveTransport(t, server, serverEnd)
+
+	status := DDPHeader{F1: ConfigFlag{Query: true}, ID: DDP_ID_STATUS}
+	query := DDPHeader{F1: ConfigFlag{Query: true}, ID: 1, Length: 5}
+	controllerEnd.WritePacket(status.Bytes(), nil)
+	controllerEnd.WritePacket(query.Bytes(), nil)
+
+	result := make(chan []byte, 1)
+	go func() {
+		buf := make([]byte, maxPacketSize)
+		if n, _, err := controllerEnd.ReadPacket(buf); err == nil {
+			result <- buf[:n]
+		}
+	}()
+
+	select {
+	case packet := <-result:
+		if header, _, _ := ParseDDPHeader(packet); header.ID != 1 {
+			t.Errorf("First reply is for ID %d, expected 1 while STATUS waits", header.ID)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("No reply to the query after STATUS in time")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown = %v, expected it not to wait for the delayed reply", err)
+	}
+}
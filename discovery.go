@@ -0,0 +1,125 @@
+package ddp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// DefaultDiscoveryTimeout is how long Discover collects replies,
+// long enough for displays delaying their reply by the last byte of their MAC
+const DefaultDiscoveryTimeout = 500 * time.Millisecond
+
+// Device is a display found by Discover
+type Device struct {
+	Addr   *net.UDPAddr
+	Status Status
+	Raw    []byte // STATUS reply as received, Status is left empty if it isn't valid JSON
+}
+
+// IP returns the address of the device
+func (d *Device) IP() net.IP {
+	return d.Addr.IP
+}
+
+// Discover finds displays by sending a STATUS query to broadcastAddr and
+// collecting the replies for timeout (DefaultDiscoveryTimeout if zero).
+// If broadcastAddr is empty the query goes to 255.255.255.255, and the DDP port
+// is used if the address has none. A directed address works too.
+// The devices found so far are returned along with ctx.Err() if ctx is done early.
+func Discover(ctx context.Context, broadcastAddr string, timeout time.Duration) ([]Device, error) {
+	if broadcastAddr == "" {
+		broadcastAddr = "255.255.255.255"
+	}
+	if _, _, err := net.SplitHostPort(broadcastAddr); err != nil {
+		broadcastAddr = net.JoinHostPort(broadcastAddr, fmt.Sprint(DDP_PORT))
+	}
+
+	addr, err := net.ResolveUDPAddr("udp4", broadcastAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve address: %w", err)
+	}
+
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on UDP: %w", err)
+	}
+	defer conn.Close()
+
+	if timeout <= 0 {
+		timeout = DefaultDiscoveryTimeout
+	}
+	conn.SetReadDeadline(time.Now().Add(timeout))
+
+	// Unblock the read as soon as ctx is done
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetReadDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+
+	query := DDPHeader{
+		F1: ConfigFlag{Query: true},
+		ID: DDP_ID_STATUS,
+	}
+	if _, err := conn.WriteToUDP(query.Bytes(), addr); err != nil {
+		return nil, err
+	}
+
+	var devices []Device
+	found := make(map[string]bool)
+	pending := make(map[string]*replyBuffer)
+	buf := make([]byte, 65507)
+
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return devices, ctx.Err()
+			}
+			return devices, err
+		}
+
+		header, headerSize, err := ParseDDPHeader(buf[:n])
+		if err != nil || !header.F1.Reply || header.ID != DDP_ID_STATUS {
+			continue
+		}
+
+		end := headerSize + int(header.Length)
+		if end > n {
+			end = n
+		}
+		data := make([]byte, end-headerSize)
+		copy(data, buf[headerSize:end])
+
+		key := from.String()
+		if found[key] {
+			continue
+		}
+		reply, ok := pending[key]
+		if !ok {
+			reply = &replyBuffer{}
+			pending[key] = reply
+		}
+		if !reply.add(&DDPPacket{Header: *header, Data: data}) {
+			continue
+		}
+		delete(pending, key)
+		found[key] = true
+
+		device := Device{Addr: from, Raw: reply.data}
+		var doc statusDocument
+		if json.Unmarshal(reply.data, &doc) == nil {
+			device.Status = doc.Status
+		}
+		devices = append(devices, device)
+	}
+}
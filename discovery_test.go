@@ -0,0 +1,129 @@
+package ddp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// startStatusServer starts a DDPServer answering STATUS queries with status
+func startStatusServer(t *testing.T, status string) *DDPServer {
+	t.Helper()
+
+	server := NewDDPServer()
+	server.RegisterHandler(DDP_ID_STATUS, func(packet *DDPPacket, addr *net.UDPAddr) error {
+		if !packet.Header.F1.Query {
+			return nil
+		}
+		return server.SendReply(addr, DDP_ID_STATUS, 0, []byte(status))
+	})
+
+	go func() {
+		if err := server.Listen("127.0.0.1:0"); err != nil {
+			t.Logf("Server error: %v", err)
+		}
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	t.Cleanup(func() { server.Close() })
+
+	return server
+}
+
+// Test Discover finds a display and parses its status
+func TestDiscover(t *testing.T) {
+	server := startStatusServer(t, `{"status":{"man":"Minleon","mod":"NDB","ver":"1.0","mac":"00:11:22:33:44:55","push":true,"ntp":true}}`)
+	serverAddr := server.Addr().String()
+
+	devices, err := Discover(context.Background(), serverAddr, 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+
+	if len(devices) != 1 {
+		t.Fatalf("Found %d devices, expected 1", len(devices))
+	}
+
+	device := devices[0]
+	if !device.IP().Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("IP = %v, expected 127.0.0.1", device.IP())
+	}
+	if device.Addr.String() != serverAddr {
+		t.Errorf("Addr = %v, expected %s", device.Addr, serverAddr)
+	}
+
+	expected := Status{
+		Manufacturer: "Minleon",
+		Model:        "NDB",
+		Version:      "1.0",
+		MAC:          "00:11:22:33:44:55",
+		Push:         true,
+		NTP:          true,
+	}
+	if device.Status != expected {
+		t.Errorf("Status = %+v, expected %+v", device.Status, expected)
+	}
+}
+
+// Test Discover keeps devices whose status isn't valid JSON
+func TestDiscoverInvalidStatus(t *testing.T) {
+	server := startStatusServer(t, "not json")
+
+	devices, err := Discover(context.Background(), server.Addr().String(), 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+
+	if len(devices) != 1 {
+		t.Fatalf("Found %d devices, expected 1", len(devices))
+	}
+	if string(devices[0].Raw) != "not json" {
+		t.Errorf("Raw = %q, expected %q", devices[0].Raw, "not json")
+	}
+	if devices[0].Status != (Status{}) {
+		t.Errorf("Status = %+v, expected empty", devices[0].Status)
+	}
+}
+
+// Test Discover with no displays returns nothing after the timeout
+func TestDiscoverNoDevices(t *testing.T) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	devices, err := Discover(context.Background(), conn.LocalAddr().String(), 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	if len(devices) != 0 {
+		t.Errorf("Found %d devices, expected 0", len(devices))
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Discover returned after %v, before the timeout", elapsed)
+	}
+}
+
+// Test Discover stops early when the context is cancelled
+func TestDiscoverCancel(t *testing.T) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err = Discover(ctx, conn.LocalAddr().String(), 5*time.Second)
+	if err != context.Canceled {
+		t.Errorf("Error = %v, expected context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Discover took %v after cancel", elapsed)
+	}
+}
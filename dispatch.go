@@ -0,0 +1,122 @@
+package ddp
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// MaxQueuedPackets is how many received packets may wait for or run in a handler at
+// once. Each holds a receive buffer of up to 64KiB, so further packets are dropped
+// and reported with ErrServerBusy until handlers catch up.
+const MaxQueuedPackets = 1024
+
+// DispatchMode controls how received packets are handed to handlers
+type DispatchMode int
+
+const (
+	// DispatchConcurrent handles every packet in its own goroutine, in no particular order
+	DispatchConcurrent DispatchMode = iota
+	// DispatchOrdered handles packets from the same source address and ID one at a
+	// time in the order they were received, while different sources run concurrently.
+	// A Push is then never handled before the data sent ahead of it.
+	DispatchOrdered
+)
+
+// SetDispatchMode sets how packets are handed to handlers, defaults to DispatchConcurrent
+func (s *DDPServer) SetDispatchMode(mode DispatchMode) {
+	s.dispatchMode = mode
+}
+
+// dispatch hands a received packet to a goroutine according to the dispatch mode,
+// or drops it if MaxQueuedPackets are already waiting
+func (s *DDPServer) dispatch(pb *packetBuffer, n int, addr *net.UDPAddr) {
+	if atomic.AddInt32(&s.queued, 1) > MaxQueuedPackets {
+		atomic.AddInt32(&s.queued, -1)
+		pb.release()
+		s.reportError(fmt.Errorf("packet from %s: %w", addr, ErrServerBusy))
+		return
+	}
+	s.inflight.Add(1)
+
+	done := func() {
+		atomic.AddInt32(&s.queued, -1)
+		s.inflight.Done()
+	}
+
+	if s.dispatchMode != DispatchOrdered {
+		// Parse packet in a goroutine to avoid blocking
+		go func() {
+			defer done()
+			s.handleBuffer(pb, n, addr)
+		}()
+		return
+	}
+
+	// Packets too short to carry an ID are queued with ID 0, the parser rejects them
+	key := sourceKey{addr: addr.String()}
+	if n > 3 {
+		key.id = pb.data[3]
+	}
+	s.ordered.enqueue(key, func() {
+		defer done()
+		s.handleBuffer(pb, n, addr)
+	})
+}
+
+// sourceKey identifies a stream of packets from one sender to one ID
+type sourceKey struct {
+	addr string
+	id   byte
+}
+
+// orderedDispatcher runs jobs one at a time per key, with a goroutine per active key
+type orderedDispatcher struct {
+	mu     sync.Mutex
+	queues map[sourceKey]*jobQueue
+}
+
+// jobQueue is the backlog of a single key
+type jobQueue struct {
+	jobs []func()
+}
+
+// enqueue adds a job for key, starting a worker if the key has none
+func (d *orderedDispatcher) enqueue(key sourceKey, job func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.queues == nil {
+		d.queues = make(map[sourceKey]*jobQueue)
+	}
+
+	q, running := d.queues[key]
+	if !running {
+		q = &jobQueue{}
+		d.queues[key] = q
+	}
+	q.jobs = append(q.jobs, job)
+
+	if !running {
+		go d.run(key, q)
+	}
+}
+
+// run works through a key's queue, the worker exits once the queue is empty
+func (d *orderedDispatcher) run(key sourceKey, q *jobQueue) {
+	for {
+		d.mu.Lock()
+		if len(q.jobs) == 0 {
+			delete(d.queues, key)
+			d.mu.Unlock()
+			return
+		}
+		job := q.jobs[0]
+		q.jobs[0] = nil
+		q.jobs = q.jobs[1:]
+		d.mu.Unlock()
+
+		job()
+	}
+}
@@ -0,0 +1,195 @@
+package ddp
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test jobs for the same key run in order
+func TestOrderedDispatcherOrder(t *testing.T) {
+	var d orderedDispatcher
+	key := sourceKey{addr: "127.0.0.1:1234", id: 1}
+
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+
+	for i := 0; i < 100; i++ {
+		i := i
+		wg.Add(1)
+		d.enqueue(key, func() {
+			defer wg.Done()
+			if i%10 == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+
+	for i, v := range order {
+		if v != i {
+			t.Fatalf("Job %d ran at position %d", v, i)
+		}
+	}
+}
+
+// Test different keys run concurrently
+func TestOrderedDispatcherConcurrentKeys(t *testing.T) {
+	var d orderedDispatcher
+
+	release := make(chan struct{})
+	done := make(chan struct{})
+
+	// The first source blocks until the second source has run
+	d.enqueue(sourceKey{addr: "a", id: 1}, func() {
+		<-release
+	})
+	d.enqueue(sourceKey{addr: "b", id: 1}, func() {
+		close(release)
+	})
+	d.enqueue(sourceKey{addr: "a", id: 1}, func() {
+		close(done)
+	})
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Sources were not handled concurrently")
+	}
+}
+
+// Test idle workers are cleaned up
+func TestOrderedDispatcherCleanup(t *testing.T) {
+	var d orderedDispatcher
+
+	ran := make(chan struct{})
+	d.enqueue(sourceKey{addr: "a", id: 1}, func() {
+		close(ran)
+	})
+	<-ran
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		d.mu.Lock()
+		remaining := len(d.queues)
+		d.mu.Unlock()
+
+		if remaining == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Queues remaining = %d, expected 0", remaining)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Test the server handles packets from one source in order
+func TestDDPServerOrderedDispatch(t *testing.T) {
+	server := NewDDPServer()
+	server.SetDispatchMode(DispatchOrdered)
+
+	const packets = 40
+
+	var mu sync.Mutex
+	var offsets []uint32
+	var wg sync.WaitGroup
+	wg.Add(packets)
+
+	server.RegisterHandler(1, func(packet *DDPPacket, addr *net.UDPAddr) error {
+		defer wg.Done()
+		// Make earlier packets slower so concurrent handling would reorder them
+		time.Sleep(time.Duration(packets-packet.Header.Offset) * 100 * time.Microsecond)
+		mu.Lock()
+		offsets = append(offsets, packet.Header.Offset)
+		mu.Unlock()
+		return nil
+	})
+
+	go func() {
+		if err := server.Listen("127.0.0.1:0"); err != nil {
+			t.Logf("Server error: %v", err)
+		}
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	defer server.Close()
+
+	controller := NewDDPController()
+	if err := controller.ConnectUDP(server.Addr().String()); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer controller.Close()
+
+	for i := 0; i < packets; i++ {
+		if _, err := controller.WriteOffset([]byte{1, 2, 3}, uint32(i)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for packets")
+	}
+
+	for i, offset := range offsets {
+		if offset != uint32(i) {
+			t.Fatalf("Packet with offset %d handled at position %d", offset, i)
+		}
+	}
+}
+
+// Test packets past MaxQueuedPackets are dropped and reported while handlers are busy
+func TestDispatchQueueLimit(t *testing.T) {
+	server, errs := collectErrors()
+
+	release := make(chan struct{})
+	server.RegisterHandler(1, func(packet *DDPPacket, addr *net.UDPAddr) error {
+		<-release
+		return nil
+	})
+
+	controllerEnd, serverEnd := NewMemoryTransportPair()
+	serveTransport(t, server, serverEnd)
+	defer close(release)
+
+	// Without a sequence number the copies aren't dropped as duplicates
+	h := DefaultDDPHeader()
+	h.SequenceNumber = 0
+	h.Length = 1
+	packet := append(h.Bytes(), 0)
+	for i := 0; i < MaxQueuedPackets+10; i++ {
+		controllerEnd.WritePacket(packet, nil)
+	}
+
+	busy := func() int {
+		count := 0
+		for _, err := range errs() {
+			if errors.Is(err, ErrServerBusy) {
+				count++
+			}
+		}
+		return count
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for busy() < 10 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if count := busy(); count != 10 {
+		t.Errorf("%d packets dropped as busy, expected 10", count)
+	}
+}
@@ -0,0 +1,115 @@
+package ddp
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// DMX transit sends legacy DMX512 universes over DDP to DDP_ID_DMX.
+// The header's Offset is the universe number and the data is the START code
+// followed by up to 512 slots.
+
+const (
+	DMX_MAX_SLOTS = 512
+
+	DMX_START_NULL         = 0x00 // dimmer and other level data
+	DMX_START_TEXT         = 0x17 // ASCII text packet
+	DMX_START_TEST         = 0x55 // test packet
+	DMX_START_UTF8         = 0x90 // UTF-8 text packet
+	DMX_START_MANUFACTURER = 0x91 // manufacturer ID
+	DMX_START_RDM          = 0xCC // Remote Device Management
+	DMX_START_SYSTEM_INFO  = 0xCF // system information packet
+)
+
+// validStartCode reports if code may be sent: any code except 0x92-0xCD, which
+// DMX512-A keeps for its own future use, other than DMX_START_RDM. Manufacturer
+// and experimental alternate START codes such as 0xDD and 0xF0-0xF7 are allowed.
+func validStartCode(code byte) bool {
+	return code == DMX_START_RDM || code < 0x92 || code > 0xCD
+}
+
+// DMXHandler is called with a DMX universe received over DDP.
+// slots are only valid until the handler returns.
+type DMXHandler func(universe uint32, startCode byte, slots []byte, addr *net.UDPAddr) error
+
+// parseDMX splits the data of a DMX transit packet into its START code and slots
+func parseDMX(data []byte) (byte, []byte, error) {
+	if len(data) == 0 {
+		return 0, nil, fmt.Errorf("DMX packet has no START code")
+	}
+	if len(data) > DMX_MAX_SLOTS+1 {
+		return 0, nil, fmt.Errorf("DMX packet has %d slots, maximum is %d", len(data)-1, DMX_MAX_SLOTS)
+	}
+	return data[0], data[1:], nil
+}
+
+// WriteDMXUniverse sends one DMX universe to the display: the START code
+// followed by up to 512 slots. START codes reserved by DMX512-A are refused,
+// whether the display understands the code is up to the caller.
+func (c *DDPController) WriteDMXUniverse(universe uint32, startCode byte, slots []byte) (int, error) {
+	return c.WriteDMXUniverseContext(context.Background(), universe, startCode, slots)
+}
+
+// WriteDMXUniverseContext is WriteDMXUniverse, giving up if ctx is done before the packet is sent
+func (c *DDPController) WriteDMXUniverseContext(ctx context.Context, universe uint32, startCode byte, slots []byte) (int, error) {
+	if len(slots) > DMX_MAX_SLOTS {
+		return 0, fmt.Errorf("%d DMX slots exceeds maximum of %d", len(slots), DMX_MAX_SLOTS)
+	}
+	if !validStartCode(startCode) {
+		return 0, fmt.Errorf("invalid DMX START code 0x%02X", startCode)
+	}
+
+	h := DDPHeader{
+		F1:     ConfigFlag{Push: true},
+		ID:     DDP_ID_DMX,
+		Offset: universe,
+	}
+	return c.writePacket(ctx, h, append([]byte{startCode}, slots...))
+}
+
+// SetDMXHandler sets a handler for DMX the display sends back on its own, such as
+// RDM responses. Errors returned by the handler are ignored.
+func (c *DDPController) SetDMXHandler(handler DMXHandler) {
+	c.replyLock.Lock()
+	defer c.replyLock.Unlock()
+
+	c.dmxHandler = handler
+}
+
+// handleDMX passes an unsolicited DMX reply to the DMX handler, if any
+func (c *DDPController) handleDMX(packet *DDPPacket, addr *net.UDPAddr) {
+	c.replyLock.Lock()
+	handler := c.dmxHandler
+	c.replyLock.Unlock()
+
+	if handler == nil {
+		return
+	}
+
+	startCode, slots, err := parseDMX(packet.Data)
+	if err != nil {
+		return
+	}
+	handler(packet.Header.Offset, startCode, slots, addr)
+}
+
+// RegisterDMXHandler registers a handler for DMX universes sent to DDP_ID_DMX
+func (s *DDPServer) RegisterDMXHandler(handler DMXHandler) {
+	s.RegisterHandler(DDP_ID_DMX, func(packet *DDPPacket, addr *net.UDPAddr) error {
+		startCode, slots, err := parseDMX(packet.Data)
+		if err != nil {
+			return err
+		}
+		return handler(packet.Header.Offset, startCode, slots, addr)
+	})
+}
+
+// SendDMXReply sends a DMX universe back to addr as an unsolicited Reply,
+// such as an RDM response
+func (s *DDPServer) SendDMXReply(addr *net.UDPAddr, universe uint32, startCode byte, slots []byte) error {
+	if len(slots) > DMX_MAX_SLOTS {
+		return fmt.Errorf("%d DMX slots exceeds maximum of %d", len(slots), DMX_MAX_SLOTS)
+	}
+	return s.SendReply(addr, DDP_ID_DMX, universe, append([]byte{startCode}, slots...))
+}
@@ -0,0 +1,117 @@
+package ddp
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+// dmxUniverse is a DMX universe as received by a handler
+type dmxUniverse struct {
+	universe  uint32
+	startCode byte
+	slots     []byte
+}
+
+// Test a DMX universe sent by the controller reaches the server's DMX handler,
+// and a DMX reply from the server reaches the controller's
+func TestDMXRoundtrip(t *testing.T) {
+	server := NewDDPServer()
+	controllerEnd, serverEnd := NewMemoryTransportPair()
+
+	received := make(chan dmxUniverse, 1)
+	server.RegisterDMXHandler(func(universe uint32, startCode byte, slots []byte, addr *net.UDPAddr) error {
+		received <- dmxUniverse{universe, startCode, append([]byte(nil), slots...)}
+		return server.SendDMXReply(addr, universe, DMX_START_RDM, []byte{0xAA, 0xBB})
+	})
+	serveTransport(t, server, serverEnd)
+
+	replies := make(chan dmxUniverse, 1)
+	controller := NewDDPController()
+	controller.SetDMXHandler(func(universe uint32, startCode byte, slots []byte, addr *net.UDPAddr) error {
+		replies <- dmxUniverse{universe, startCode, append([]byte(nil), slots...)}
+		return nil
+	})
+	controller.Connect(controllerEnd)
+	defer controller.Close()
+
+	slots := make([]byte, DMX_MAX_SLOTS)
+	for i := range slots {
+		slots[i] = byte(i)
+	}
+	if _, err := controller.WriteDMXUniverse(7, DMX_START_NULL, slots); err != nil {
+		t.Fatalf("WriteDMXUniverse failed: %v", err)
+	}
+
+	select {
+	case u := <-received:
+		if u.universe != 7 || u.startCode != DMX_START_NULL || !bytes.Equal(u.slots, slots) {
+			t.Errorf("Received universe %d start code 0x%02X with %d slots, expected universe 7 start code 0x00 with %d slots",
+				u.universe, u.startCode, len(u.slots), len(slots))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for DMX")
+	}
+
+	select {
+	case u := <-replies:
+		if u.universe != 7 || u.startCode != DMX_START_RDM || !bytes.Equal(u.slots, []byte{0xAA, 0xBB}) {
+			t.Errorf("Reply = %+v, expected universe 7 RDM [AA BB]", u)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for DMX reply")
+	}
+}
+
+// Test the controller refuses DMX it can't send
+func TestWriteDMXUniverseInvalid(t *testing.T) {
+	controller, mock := newMockController()
+
+	if _, err := controller.WriteDMXUniverse(1, DMX_START_NULL, make([]byte, DMX_MAX_SLOTS+1)); err == nil {
+		t.Error("Expected error for too many slots")
+	}
+	if _, err := controller.WriteDMXUniverse(1, 0xA0, []byte{1}); err == nil {
+		t.Error("Expected error for a reserved START code")
+	}
+	if len(mock.data) != 0 {
+		t.Errorf("Wrote %d bytes, expected none", len(mock.data))
+	}
+}
+
+// Test alternate START codes outside the reserved range are sent
+func TestWriteDMXUniverseAlternateStartCodes(t *testing.T) {
+	for _, code := range []byte{0x42, 0xCC, 0xDD, 0xF0, 0xF7} {
+		controller, mock := newMockController()
+		if _, err := controller.WriteDMXUniverse(1, code, []byte{1}); err != nil {
+			t.Errorf("WriteDMXUniverse with START code 0x%02X failed: %v", code, err)
+			continue
+		}
+		if _, size, _ := ParseDDPHeader(mock.data); mock.data[size] != code {
+			t.Errorf("START code = 0x%02X, expected 0x%02X", mock.data[size], code)
+		}
+	}
+}
+
+// Test the DMX packet layout
+func TestWriteDMXUniversePacket(t *testing.T) {
+	controller, mock := newMockController()
+
+	if _, err := controller.WriteDMXUniverse(0x010203, DMX_START_NULL, []byte{10, 20}); err != nil {
+		t.Fatalf("WriteDMXUniverse failed: %v", err)
+	}
+
+	header, size, err := ParseDDPHeader(mock.data)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if header.ID != DDP_ID_DMX {
+		t.Errorf("ID = %d, expected %d", header.ID, DDP_ID_DMX)
+	}
+	if header.Offset != 0x010203 {
+		t.Errorf("Offset = %#x, expected universe 0x010203", header.Offset)
+	}
+	if !bytes.Equal(mock.data[size:], []byte{DMX_START_NULL, 10, 20}) {
+		t.Errorf("Data = %v, expected START code and slots", mock.data[size:])
+	}
+}
@@ -0,0 +1,60 @@
+package ddp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Errors reported by the server's receive path, wrapped with details.
+// Use errors.Is to tell them apart.
+var (
+	ErrShortHeader     = errors.New("packet shorter than DDP header")
+	ErrPayloadMismatch = errors.New("payload does not match Length")
+	ErrNoHandler       = errors.New("no handler for ID")
+	ErrFrameOverflow   = errors.New("data past the end of the frame buffer")
+	ErrServerBusy      = errors.New("too many packets waiting to be handled")
+)
+
+// HandlerError is a packet, frame or DMX handler returning an error
+type HandlerError struct {
+	ID   byte
+	Addr *net.UDPAddr // sender of the packet, nil for frame handlers
+	Err  error
+}
+
+func (e *HandlerError) Error() string {
+	if e.Addr == nil {
+		return fmt.Sprintf("handler for ID %d: %v", e.ID, e.Err)
+	}
+	return fmt.Sprintf("handler for ID %d from %s: %v", e.ID, e.Addr, e.Err)
+}
+
+func (e *HandlerError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorHandler is called with every error in the server's receive path: packets
+// that can't be parsed or are dropped, packets nobody handles, handler errors and
+// failed reads. In ParseLenient mode problems with packets that are still handled
+// are reported too. It may be called from several goroutines at once.
+type ErrorHandler func(err error)
+
+// SetErrorHandler sets where receive errors go, they are discarded by default
+func (s *DDPServer) SetErrorHandler(handler ErrorHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.errorHandler = handler
+}
+
+// reportError passes err to the error handler, if any
+func (s *DDPServer) reportError(err error) {
+	s.mu.Lock()
+	handler := s.errorHandler
+	s.mu.Unlock()
+
+	if handler != nil {
+		handler(err)
+	}
+}
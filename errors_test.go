@@ -0,0 +1,90 @@
+package ddp
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+)
+
+// collectErrors returns a server whose reported errors are collected
+func collectErrors() (*DDPServer, func() []error) {
+	server := NewDDPServer()
+
+	var mu sync.Mutex
+	var errs []error
+	server.SetErrorHandler(func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	})
+
+	return server, func() []error {
+		mu.Lock()
+		defer mu.Unlock()
+		return errs
+	}
+}
+
+// Test receive errors are reported with their typed values
+func TestServerErrorHandler(t *testing.T) {
+	server, errs := collectErrors()
+
+	handlerErr := errors.New("display on fire")
+	server.RegisterHandler(1, func(packet *DDPPacket, addr *net.UDPAddr) error {
+		return handlerErr
+	})
+
+	h := DDPHeader{F1: ConfigFlag{Push: true}, ID: 1, Length: 3}
+	server.handlePacket([]byte{0x41, 0x01}, testAddr)
+	server.handlePacket(append(h.Bytes(), 1, 2), testAddr)
+
+	other := DDPHeader{ID: 7}
+	server.handlePacket(other.Bytes(), testAddr)
+
+	reported := errs()
+	if len(reported) != 4 {
+		t.Fatalf("Reported %d errors, expected 4: %v", len(reported), reported)
+	}
+
+	if !errors.Is(reported[0], ErrShortHeader) {
+		t.Errorf("Error = %v, expected ErrShortHeader", reported[0])
+	}
+
+	// The truncated packet is reported but still handled in lenient mode
+	if !errors.Is(reported[1], ErrPayloadMismatch) {
+		t.Errorf("Error = %v, expected ErrPayloadMismatch", reported[1])
+	}
+	var he *HandlerError
+	if !errors.As(reported[2], &he) {
+		t.Fatalf("Error = %v, expected a HandlerError", reported[2])
+	}
+	if he.ID != 1 || he.Addr != testAddr || !errors.Is(he, handlerErr) {
+		t.Errorf("HandlerError = %+v, expected ID 1 from %s wrapping the handler's error", he, testAddr)
+	}
+
+	if !errors.Is(reported[3], ErrNoHandler) {
+		t.Errorf("Error = %v, expected ErrNoHandler", reported[3])
+	}
+}
+
+// Test frame handler errors are reported without an address
+func TestFrameHandlerError(t *testing.T) {
+	server, errs := collectErrors()
+
+	server.RegisterFrameHandler(1, 3, func(id byte, frame []byte) error {
+		return errors.New("failed")
+	})
+
+	h := DDPHeader{F1: ConfigFlag{Push: true}, ID: 1, Length: 3}
+	server.handlePacket(append(h.Bytes(), 1, 2, 3), testAddr)
+
+	reported := errs()
+	var he *HandlerError
+	if len(reported) != 1 || !errors.As(reported[0], &he) {
+		t.Fatalf("Reported %v, expected one HandlerError", reported)
+	}
+	if he.ID != 1 || he.Addr != nil {
+		t.Errorf("HandlerError = %+v, expected ID 1 with no address", he)
+	}
+}
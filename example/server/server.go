@@ -1,10 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
-	"os"
 	"os/signal"
 	"syscall"
 
@@ -43,19 +43,20 @@ func main() {
 		return nil
 	})
 
+	// Report packets that couldn't be handled
+	server.SetErrorHandler(func(err error) {
+		log.Printf("Receive error: %v", err)
+	})
+
+	// Stop on interrupt, letting running handlers finish
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	// Start server
 	fmt.Println("Starting DDP server on port 4048...")
-	go func() {
-		if err := server.Listen(""); err != nil {
-			log.Fatalf("Server error: %v", err)
-		}
-	}()
-
-	// Wait for interrupt signal
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	if err := server.ListenAndServe(ctx, ""); err != nil {
+		log.Fatalf("Server error: %v", err)
+	}
 
-	fmt.Println("\nShutting down server...")
-	server.Close()
+	fmt.Println("\nServer stopped")
 }
@@ -0,0 +1,141 @@
+package ddp
+
+import (
+	"fmt"
+	"sync"
+)
+
+// FrameHandler is called with the complete frame buffer of an ID when it is displayed.
+// The frame is a copy that the handler may keep.
+type FrameHandler func(id byte, frame []byte) error
+
+// PushMode controls when a frame buffer is displayed
+type PushMode int
+
+const (
+	// PushOnFlag displays the frame buffer when a packet with the Push flag arrives
+	PushOnFlag PushMode = iota
+	// PushEveryPacket displays the frame buffer after every packet, for senders that never set Push
+	PushEveryPacket
+)
+
+// MaxFrameSize is the largest a frame buffer registered with size 0 grows to
+const MaxFrameSize = 16 << 20
+
+// frameBuffer holds the output frame of a single ID in display mode
+type frameBuffer struct {
+	mu      sync.Mutex
+	data    []byte
+	limit   int // the buffer never grows past this
+	handler FrameHandler
+}
+
+// write places data at offset, growing the buffer up to its limit if needed.
+// Data past the limit is dropped and ErrFrameOverflow returned.
+func (fb *frameBuffer) write(offset uint32, data []byte) error {
+	var err error
+	if int64(offset)+int64(len(data)) > int64(fb.limit) {
+		err = fmt.Errorf("%w: %d bytes at offset %d, limit is %d", ErrFrameOverflow, len(data), offset, fb.limit)
+		if int64(offset) >= int64(fb.limit) {
+			return err
+		}
+		data = data[:fb.limit-int(offset)]
+	}
+
+	end := int(offset) + len(data)
+	if end > len(fb.data) {
+		fb.data = append(fb.data, make([]byte, end-len(fb.data))...)
+	}
+	copy(fb.data[offset:end], data)
+	return err
+}
+
+// snapshot returns a copy of the frame buffer
+func (fb *frameBuffer) snapshot() []byte {
+	frame := make([]byte, len(fb.data))
+	copy(frame, fb.data)
+	return frame
+}
+
+// RegisterFrameHandler puts id in display mode: the server keeps a frame buffer of
+// size bytes for it, writes each packet's data at its offset, and calls handler with
+// the whole buffer when it is displayed (see SetPushMode). Data written past size is
+// dropped and reported, unless size is 0, which lets the buffer grow with the data
+// up to MaxFrameSize. The buffer is not cleared between frames, so senders can send
+// only what changed. Packet handlers are not called for IDs in display mode, and
+// Queries are answered from the buffer.
+func (s *DDPServer) RegisterFrameHandler(id byte, size int, handler FrameHandler) {
+	limit := size
+	if size <= 0 {
+		size, limit = 0, MaxFrameSize
+	}
+	s.frames[id] = &frameBuffer{
+		data:    make([]byte, size),
+		limit:   limit,
+		handler: handler,
+	}
+}
+
+// SetPushMode sets when frame buffers are displayed, defaults to PushOnFlag
+func (s *DDPServer) SetPushMode(mode PushMode) {
+	s.pushMode = mode
+}
+
+// display writes a packet into its frame buffer and displays the frame on Push
+func (s *DDPServer) display(fb *frameBuffer, packet *DDPPacket) {
+	h := &packet.Header
+
+	// Only writes go into the buffer
+	if h.F1.Query || h.F1.Reply {
+		return
+	}
+
+	// Storage packets name the data to fill the whole buffer with, growable
+	// buffers take as much as the unit has
+	offset, data := h.Offset, packet.Data
+	if h.F1.Storage {
+		fb.mu.Lock()
+		size, limit := len(fb.data), fb.limit
+		fb.mu.Unlock()
+
+		var err error
+		data, err = s.readStorage(string(packet.Data), h.Offset, size, limit)
+		if err != nil {
+			s.reportError(fmt.Errorf("storage for ID %d: %w", h.ID, err))
+			return
+		}
+		offset = 0
+	}
+
+	push := h.F1.Push || s.pushMode == PushEveryPacket
+
+	// Late data still goes into the buffer, the policy only decides whether it is displayed
+	fb.mu.Lock()
+	err := fb.write(offset, data)
+	var frame []byte
+	if push {
+		frame = fb.snapshot()
+	}
+	fb.mu.Unlock()
+
+	if err != nil {
+		s.reportError(fmt.Errorf("packet for ID %d: %w", h.ID, err))
+	}
+	if !push {
+		return
+	}
+
+	if h.F1.Push && h.F1.Timecode {
+		s.schedule(fb, h.ID, h.Timecode, frame)
+		return
+	}
+
+	s.present(fb, h.ID, frame)
+}
+
+// present hands a frame to the ID's frame handler
+func (s *DDPServer) present(fb *frameBuffer, id byte, frame []byte) {
+	if err := fb.handler(id, frame); err != nil {
+		s.reportError(&HandlerError{ID: id, Err: err})
+	}
+}
@@ -0,0 +1,197 @@
+package ddp
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+)
+
+var testAddr = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4048}
+
+// feedServer hands every packet written to the mock straight to the server
+func feedServer(t *testing.T, server *DDPServer, mock *mockWriteCloser) {
+	t.Helper()
+
+	for _, p := range splitPackets(t, mock.data) {
+		server.handlePacket(append(p.Header.Bytes(), p.Data...), testAddr)
+	}
+	mock.data = nil
+}
+
+// Test a frame is displayed once when Push arrives
+func TestFrameHandler(t *testing.T) {
+	server := NewDDPServer()
+
+	var frames [][]byte
+	server.RegisterFrameHandler(1, 0, func(id byte, frame []byte) error {
+		if id != 1 {
+			t.Errorf("ID = %d, expected 1", id)
+		}
+		frames = append(frames, frame)
+		return nil
+	})
+
+	controller, mock := newMockController()
+	frame := make([]byte, 2000*3)
+	for i := range frame {
+		frame[i] = byte(i % 251)
+	}
+	if _, err := controller.WriteFrame(frame); err != nil {
+		t.Fatalf("WriteFrame failed: %v", err)
+	}
+	feedServer(t, server, mock)
+
+	if len(frames) != 1 {
+		t.Fatalf("Frames displayed = %d, expected 1", len(frames))
+	}
+	if !bytes.Equal(frames[0], frame) {
+		t.Error("Displayed frame does not match sent frame")
+	}
+}
+
+// Test the buffer is not cleared between frames
+func TestFrameHandlerKeepsBuffer(t *testing.T) {
+	server := NewDDPServer()
+
+	var last []byte
+	server.RegisterFrameHandler(1, 9, func(id byte, frame []byte) error {
+		last = frame
+		return nil
+	})
+
+	controller, mock := newMockController()
+	controller.WriteOffset([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9}, 0)
+	feedServer(t, server, mock)
+
+	// Only update the middle pixel
+	controller.WriteOffset([]byte{50, 50, 50}, 3)
+	feedServer(t, server, mock)
+
+	expected := []byte{1, 2, 3, 50, 50, 50, 7, 8, 9}
+	if !bytes.Equal(last, expected) {
+		t.Errorf("Frame = %v, expected %v", last, expected)
+	}
+}
+
+// Test data without Push is buffered until a bare Push arrives
+func TestFrameHandlerBarePush(t *testing.T) {
+	server := NewDDPServer()
+
+	displayed := 0
+	var last []byte
+	server.RegisterFrameHandler(1, 6, func(id byte, frame []byte) error {
+		displayed++
+		last = frame
+		return nil
+	})
+
+	controller, mock := newMockController()
+	controller.header.F1.Push = false
+	controller.Write([]byte{9, 9, 9})
+	feedServer(t, server, mock)
+
+	if displayed != 0 {
+		t.Fatalf("Frame displayed %d times before Push", displayed)
+	}
+
+	controller.header.F1.Push = true
+	controller.WriteOffset(nil, 0)
+	feedServer(t, server, mock)
+
+	if displayed != 1 {
+		t.Fatalf("Frames displayed = %d, expected 1", displayed)
+	}
+	if !bytes.Equal(last, []byte{9, 9, 9, 0, 0, 0}) {
+		t.Errorf("Frame = %v, expected [9 9 9 0 0 0]", last)
+	}
+}
+
+// Test PushEveryPacket displays without Push
+func TestFrameHandlerPushEveryPacket(t *testing.T) {
+	server := NewDDPServer()
+	server.SetPushMode(PushEveryPacket)
+
+	displayed := 0
+	server.RegisterFrameHandler(1, 3, func(id byte, frame []byte) error {
+		displayed++
+		return nil
+	})
+
+	controller, mock := newMockController()
+	controller.header.F1.Push = false
+	controller.Write([]byte{1, 2, 3})
+	controller.Write([]byte{4, 5, 6})
+	feedServer(t, server, mock)
+
+	if displayed != 2 {
+		t.Errorf("Frames displayed = %d, expected 2", displayed)
+	}
+}
+
+// Test frame handlers take precedence over packet handlers for their ID
+func TestFrameHandlerOverridesPacketHandler(t *testing.T) {
+	server := NewDDPServer()
+
+	packets := 0
+	server.RegisterDefaultHandler(func(packet *DDPPacket, addr *net.UDPAddr) error {
+		packets++
+		return nil
+	})
+	frames := 0
+	server.RegisterFrameHandler(1, 3, func(id byte, frame []byte) error {
+		frames++
+		return nil
+	})
+
+	controller, mock := newMockController()
+	controller.Write([]byte{1, 2, 3})
+	controller.SetID(2)
+	controller.Write([]byte{1, 2, 3})
+	feedServer(t, server, mock)
+
+	if frames != 1 {
+		t.Errorf("Frames displayed = %d, expected 1", frames)
+	}
+	if packets != 1 {
+		t.Errorf("Packets handled = %d, expected 1", packets)
+	}
+}
+
+// Test data past the registered size is dropped and reported rather than growing the buffer
+func TestFrameBufferLimit(t *testing.T) {
+	server, errs := collectErrors()
+
+	var frames [][]byte
+	server.RegisterFrameHandler(1, 3, func(id byte, frame []byte) error {
+		frames = append(frames, frame)
+		return nil
+	})
+	server.RegisterFrameHandler(2, 0, func(id byte, frame []byte) error {
+		frames = append(frames, frame)
+		return nil
+	})
+
+	h := DDPHeader{F1: ConfigFlag{Push: true}, ID: 1, Length: 5}
+	server.handlePacket(append(h.Bytes(), 1, 2, 3, 4, 5), testAddr)
+
+	// A huge offset must not allocate, even for a buffer that can grow
+	for _, id := range []byte{1, 2} {
+		h = DDPHeader{F1: ConfigFlag{Push: true}, ID: id, Offset: 0xFFFFFF00, Length: 3}
+		server.handlePacket(append(h.Bytes(), 1, 2, 3), testAddr)
+	}
+
+	if len(frames) != 3 || !bytes.Equal(frames[0], []byte{1, 2, 3}) || len(frames[1]) != 3 || len(frames[2]) != 0 {
+		t.Errorf("Frames = %v, expected the data clipped to the buffer", frames)
+	}
+
+	reported := errs()
+	if len(reported) != 3 {
+		t.Fatalf("Reported %v, expected 3 errors", reported)
+	}
+	for _, err := range reported {
+		if !errors.Is(err, ErrFrameOverflow) {
+			t.Errorf("Error = %v, expected ErrFrameOverflow", err)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package ddp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// groupMember is a display in a DDPGroup and the part of the frame it shows
+type groupMember struct {
+	controller *DDPController
+	start      int
+	length     int
+}
+
+// DDPGroup sends one frame to many displays and shows it on all of them at once.
+// Each display gets its slice of the frame without Push, then a single zero-length
+// Push to the display ID is sent to the push address so all displays flip together.
+// A group with only one display pushes on its last data packet instead.
+type DDPGroup struct {
+	mu       sync.Mutex
+	members  []groupMember
+	push     *DDPController // sends the Push to all displays, nil until needed
+	timecode *uint32        // timecode put on the Push, if set
+}
+
+// NewDDPGroup returns an empty group. Displays are added with AddDevice or AddController.
+func NewDDPGroup() *DDPGroup {
+	return &DDPGroup{}
+}
+
+// AddDevice connects to the display at addr over UDP and adds it to the group,
+// showing length bytes of the frame starting at start
+func (g *DDPGroup) AddDevice(addr string, start int, length int) error {
+	c := NewDDPController()
+	if err := c.ConnectUDP(addr); err != nil {
+		return err
+	}
+
+	return g.AddController(c, start, length)
+}
+
+// AddController adds a connected controller to the group, showing length bytes of
+// the frame starting at start. The controller's header is used for the data packets
+// and the group closes it on Close.
+func (g *DDPGroup) AddController(c *DDPController, start int, length int) error {
+	if start < 0 || length < 0 {
+		return fmt.Errorf("invalid frame slice %d+%d", start, length)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.members = append(g.members, groupMember{controller: c, start: start, length: length})
+	return nil
+}
+
+// SetPushAddr sets where the Push is sent, a broadcast or multicast address that
+// reaches every display in the group. Defaults to 255.255.255.255 on the DDP port.
+// The port is added if addr has none.
+func (g *DDPGroup) SetPushAddr(addr string) error {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, fmt.Sprint(DDP_PORT))
+	}
+
+	c := NewDDPController()
+	if err := c.ConnectUDP(addr); err != nil {
+		return err
+	}
+
+	g.setPush(c)
+	return nil
+}
+
+// SetPushTransport sends the Push over t instead of to a push address
+func (g *DDPGroup) SetPushTransport(t Transport) {
+	c := NewDDPController()
+	c.Connect(t)
+	g.setPush(c)
+}
+
+func (g *DDPGroup) setPush(c *DDPController) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.push != nil {
+		g.push.Close()
+	}
+	g.push = c
+}
+
+// SetTimecode sends the Push with the given NTP timecode, so displays that support
+// timecodes show the frame at that time
+func (g *DDPGroup) SetTimecode(timecode uint32) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.timecode = &timecode
+}
+
+// DisableTimecode sends the Push without a timecode again
+func (g *DDPGroup) DisableTimecode() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.timecode = nil
+}
+
+// WriteFrame sends each display its slice of frame and then pushes them all at once.
+// Returns the number of frame bytes written to displays.
+func (g *DDPGroup) WriteFrame(frame []byte) (int, error) {
+	return g.WriteFrameContext(context.Background(), frame)
+}
+
+// WriteFrameContext is WriteFrame, stopping before the next packet if ctx is done.
+// Nothing is pushed unless all displays got their data.
+func (g *DDPGroup) WriteFrameContext(ctx context.Context, frame []byte) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if len(g.members) == 0 {
+		return 0, fmt.Errorf("group has no devices")
+	}
+	for _, m := range g.members {
+		if m.start+m.length > len(frame) {
+			return 0, fmt.Errorf("frame of %d bytes is too short for device at %d+%d", len(frame), m.start, m.length)
+		}
+	}
+
+	// A lone display doesn't need a separate Push
+	if len(g.members) == 1 {
+		m := g.members[0]
+		h := m.controller.currentHeader()
+		if g.timecode != nil {
+			h.F1.Timecode = true
+			h.Timecode = *g.timecode
+		}
+		return m.controller.writeChunks(ctx, h, frame[m.start:m.start+m.length], true)
+	}
+
+	written := 0
+	for _, m := range g.members {
+		h := m.controller.currentHeader()
+		h.F1.Timecode = false
+		h.Timecode = 0
+
+		n, err := m.controller.writeChunks(ctx, h, frame[m.start:m.start+m.length], false)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+
+	if g.push == nil {
+		c := NewDDPController()
+		if err := c.ConnectUDP(fmt.Sprintf("255.255.255.255:%d", DDP_PORT)); err != nil {
+			return written, err
+		}
+		g.push = c
+	}
+
+	h := NewDDPHeader(NewConfigFlag(false, false, false, false, true), 0x00, PixelDataType{RGB, Pixel8Bits, false}, DDP_ID_DISPLAY, 0, 0)
+	if g.timecode != nil {
+		h.F1.Timecode = true
+		h.Timecode = *g.timecode
+	}
+	h.SequenceNumber = g.push.nextSequence()
+	if _, err := g.push.sendPacket(ctx, h, nil); err != nil {
+		return written, err
+	}
+	return written, nil
+}
+
+// Close closes the connections to all displays in the group and the push address
+func (g *DDPGroup) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var firstErr error
+	for _, m := range g.members {
+		if err := m.controller.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	g.members = nil
+
+	if g.push != nil {
+		if err := g.push.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		g.push = nil
+	}
+	return firstErr
+}
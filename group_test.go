@@ -0,0 +1,147 @@
+package ddp
+
+import (
+	"bytes"
+	"testing"
+)
+
+// readPackets reads the packets waiting on t
+func readPackets(t *testing.T, transport Transport, count int) []*DDPPacket {
+	t.Helper()
+
+	var packets []*DDPPacket
+	buf := make([]byte, maxPacketSize)
+	for i := 0; i < count; i++ {
+		n, _, err := transport.ReadPacket(buf)
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		header, size, err := ParseDDPHeader(buf[:n])
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		data := make([]byte, n-size)
+		copy(data, buf[size:n])
+		packets = append(packets, &DDPPacket{Header: *header, Data: data})
+	}
+	return packets
+}
+
+// newGroupDevice adds a device on a memory transport to the group and returns the display end
+func newGroupDevice(t *testing.T, group *DDPGroup, start int, length int) Transport {
+	t.Helper()
+
+	local, display := NewMemoryTransportPair()
+	c := NewDDPController()
+	c.Connect(local)
+	if err := group.AddController(c, start, length); err != nil {
+		t.Fatalf("AddController failed: %v", err)
+	}
+	return display
+}
+
+// Test each display gets its slice without Push, followed by one Push for all
+func TestGroupWriteFrame(t *testing.T) {
+	group := NewDDPGroup()
+	defer group.Close()
+
+	first := newGroupDevice(t, group, 0, 2000)
+	second := newGroupDevice(t, group, 2000, 6)
+
+	local, pushed := NewMemoryTransportPair()
+	group.SetPushTransport(local)
+
+	frame := make([]byte, 2006)
+	for i := range frame {
+		frame[i] = byte(i)
+	}
+
+	written, err := group.WriteFrame(frame)
+	if err != nil {
+		t.Fatalf("WriteFrame failed: %v", err)
+	}
+	if written != len(frame) {
+		t.Errorf("Written = %d, expected %d", written, len(frame))
+	}
+
+	var got []byte
+	for _, p := range readPackets(t, first, 2) {
+		if p.Header.F1.Push {
+			t.Errorf("Packet at offset %d has Push set", p.Header.Offset)
+		}
+		got = append(got, p.Data...)
+	}
+	if !bytes.Equal(got, frame[:2000]) {
+		t.Errorf("First device got wrong data")
+	}
+
+	p := readPackets(t, second, 1)[0]
+	if p.Header.F1.Push || p.Header.Offset != 0 || !bytes.Equal(p.Data, frame[2000:]) {
+		t.Errorf("Second device got offset %d push %v data %v", p.Header.Offset, p.Header.F1.Push, p.Data)
+	}
+
+	push := readPackets(t, pushed, 1)[0]
+	if !push.Header.F1.Push || push.Header.ID != DDP_ID_DISPLAY || len(push.Data) != 0 {
+		t.Errorf("Push = %+v, expected zero-length Push to the display ID", push.Header)
+	}
+	if push.Header.F1.Timecode {
+		t.Errorf("Push has a timecode, expected none")
+	}
+}
+
+// Test the Push carries the group's timecode
+func TestGroupTimecodedPush(t *testing.T) {
+	group := NewDDPGroup()
+	defer group.Close()
+
+	first := newGroupDevice(t, group, 0, 3)
+	second := newGroupDevice(t, group, 3, 3)
+
+	local, pushed := NewMemoryTransportPair()
+	group.SetPushTransport(local)
+	group.SetTimecode(0x12345678)
+
+	if _, err := group.WriteFrame(make([]byte, 6)); err != nil {
+		t.Fatalf("WriteFrame failed: %v", err)
+	}
+
+	for _, display := range []Transport{first, second} {
+		if p := readPackets(t, display, 1)[0]; p.Header.F1.Timecode {
+			t.Errorf("Data packet has a timecode, expected none")
+		}
+	}
+
+	push := readPackets(t, pushed, 1)[0]
+	if !push.Header.F1.Timecode || push.Header.Timecode != 0x12345678 {
+		t.Errorf("Push timecode = %v %#x, expected 0x12345678", push.Header.F1.Timecode, push.Header.Timecode)
+	}
+}
+
+// Test a single display is pushed on its last packet
+func TestGroupSingleDevice(t *testing.T) {
+	group := NewDDPGroup()
+	defer group.Close()
+
+	display := newGroupDevice(t, group, 0, 3)
+
+	if _, err := group.WriteFrame([]byte{1, 2, 3}); err != nil {
+		t.Fatalf("WriteFrame failed: %v", err)
+	}
+
+	if p := readPackets(t, display, 1)[0]; !p.Header.F1.Push {
+		t.Errorf("Packet has no Push, expected it on the only packet")
+	}
+}
+
+// Test a frame too short for the group's slices is not sent
+func TestGroupShortFrame(t *testing.T) {
+	group := NewDDPGroup()
+	defer group.Close()
+
+	newGroupDevice(t, group, 0, 3)
+	newGroupDevice(t, group, 3, 3)
+
+	if _, err := group.WriteFrame(make([]byte, 5)); err == nil {
+		t.Errorf("Expected error for a frame shorter than the slices")
+	}
+}
@@ -0,0 +1,268 @@
+package ddp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Status is the read-only device information served on DDP_ID_STATUS,
+// following the schema used by Minleon NDB devices
+type Status struct {
+	Manufacturer string `json:"man,omitempty"`
+	Model        string `json:"mod,omitempty"`
+	Version      string `json:"ver,omitempty"`
+	MAC          string `json:"mac,omitempty"`
+	Push         bool   `json:"push,omitempty"` // PUSH supported
+	NTP          bool   `json:"ntp,omitempty"`  // NTP supported
+
+	// Set in unsolicited updates, e.g. {"update":"change","state":"up"} on power-up
+	Update string `json:"update,omitempty"`
+	State  string `json:"state,omitempty"`
+}
+
+// Config is the read/write device configuration on DDP_ID_CONFIG.
+// Writing replaces only the fields that are set.
+type Config struct {
+	IP      string       `json:"ip,omitempty"`
+	Netmask string       `json:"nm,omitempty"`
+	Gateway string       `json:"gw,omitempty"`
+	Ports   []PortConfig `json:"ports,omitempty"`
+
+	// Set to 1 to reboot the device and re-initialize the light strings
+	Reboot int `json:"reboot,omitempty"`
+}
+
+// PortConfig describes a single output port in Config
+type PortConfig struct {
+	Port      int `json:"port"`
+	Ts        int `json:"ts"` // number of T's
+	Lights    int `json:"l"`
+	StartSlot int `json:"ss"`
+}
+
+// Control is a command written to DDP_ID_CONTROL.
+// Numeric settings are pointers since zero is a meaningful value, use IntValue to set them.
+// Power should be sent by itself with no other settings.
+type Control struct {
+	Effect    string         `json:"fx,omitempty"`
+	Intensity *int           `json:"int,omitempty"` // 0-100
+	Speed     *int           `json:"spd,omitempty"` // 1-100
+	Direction *int           `json:"dir,omitempty"` // normal=0 or reverse=1
+	Colors    []ControlColor `json:"colors,omitempty"`
+	Favorites []Favorite     `json:"favorites,omitempty"`
+	Save      int            `json:"save,omitempty"`  // 1 saves the settings so they resume after a power cycle
+	Power     *int           `json:"power,omitempty"` // off=0 or on=1
+}
+
+// Favorite is an entry in the CONTROL favorites list
+type Favorite struct {
+	Index     int            `json:"i"` // 1-10
+	Effect    string         `json:"fx,omitempty"`
+	Time      *int           `json:"t,omitempty"` // seconds to run the effect, 0 to disable
+	Intensity *int           `json:"int,omitempty"`
+	Speed     *int           `json:"spd,omitempty"`
+	Direction *int           `json:"dir,omitempty"`
+	Colors    []ControlColor `json:"colors,omitempty"`
+}
+
+// ControlColor is a custom effect color, up to 3 can be set
+type ControlColor struct {
+	R uint8 `json:"r"`
+	G uint8 `json:"g"`
+	B uint8 `json:"b"`
+}
+
+// IntValue returns a pointer to v, for the optional numeric fields in Control and Favorite
+func IntValue(v int) *int {
+	return &v
+}
+
+// statusDocument is the JSON envelope for Status
+type statusDocument struct {
+	Status Status `json:"status"`
+}
+
+// configDocument is the JSON envelope for Config
+type configDocument struct {
+	Config Config `json:"config"`
+}
+
+// controlDocument is the JSON envelope for Control
+type controlDocument struct {
+	Control Control `json:"control"`
+}
+
+// GetStatus reads the device's JSON status
+func (c *DDPController) GetStatus() (*Status, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout())
+	defer cancel()
+
+	v, err := c.GetStatusContext(ctx)
+	return v, timeoutError(err)
+}
+
+// GetStatusContext is GetStatus, waiting for the reply until ctx is done
+func (c *DDPController) GetStatusContext(ctx context.Context) (*Status, error) {
+	var doc statusDocument
+	if err := c.queryJSON(ctx, DDP_ID_STATUS, &doc); err != nil {
+		return nil, err
+	}
+	return &doc.Status, nil
+}
+
+// GetConfig reads the device's JSON config
+func (c *DDPController) GetConfig() (*Config, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout())
+	defer cancel()
+
+	v, err := c.GetConfigContext(ctx)
+	return v, timeoutError(err)
+}
+
+// GetConfigContext is GetConfig, waiting for the reply until ctx is done
+func (c *DDPController) GetConfigContext(ctx context.Context) (*Config, error) {
+	var doc configDocument
+	if err := c.queryJSON(ctx, DDP_ID_CONFIG, &doc); err != nil {
+		return nil, err
+	}
+	return &doc.Config, nil
+}
+
+// SetConfig writes config to the device, replacing the fields that are set
+func (c *DDPController) SetConfig(config Config) error {
+	return c.SetConfigContext(context.Background(), config)
+}
+
+// SetConfigContext is SetConfig, giving up if ctx is done before it is sent
+func (c *DDPController) SetConfigContext(ctx context.Context, config Config) error {
+	return c.writeJSON(ctx, DDP_ID_CONFIG, configDocument{Config: config})
+}
+
+// SendControl writes a CONTROL command to the device
+func (c *DDPController) SendControl(control Control) error {
+	return c.SendControlContext(context.Background(), control)
+}
+
+// SendControlContext is SendControl, giving up if ctx is done before it is sent
+func (c *DDPController) SendControlContext(ctx context.Context, control Control) error {
+	return c.writeJSON(ctx, DDP_ID_CONTROL, controlDocument{Control: control})
+}
+
+// GetFavorites reads the device's favorites list from CONTROL
+func (c *DDPController) GetFavorites() ([]Favorite, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout())
+	defer cancel()
+
+	v, err := c.GetFavoritesContext(ctx)
+	return v, timeoutError(err)
+}
+
+// GetFavoritesContext is GetFavorites, waiting for the reply until ctx is done
+func (c *DDPController) GetFavoritesContext(ctx context.Context) ([]Favorite, error) {
+	var doc controlDocument
+	if err := c.queryJSON(ctx, DDP_ID_CONTROL, &doc); err != nil {
+		return nil, err
+	}
+	return doc.Control.Favorites, nil
+}
+
+// queryJSON reads the whole JSON document from id into v
+func (c *DDPController) queryJSON(ctx context.Context, id byte, v interface{}) error {
+	// A length of 0 asks for the whole document, as in the spec's STATUS example
+	data, err := c.QueryContext(ctx, id, 0, 0)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("ID %d is not readable", id)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid JSON from ID %d: %w", id, err)
+	}
+	return nil
+}
+
+// writeJSON writes v as a JSON document to id, split across packets if needed
+func (c *DDPController) writeJSON(ctx context.Context, id byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	h := DDPHeader{ID: id}
+	_, err = c.writeChunks(ctx, h, data, true)
+	return err
+}
+
+// MaxJSONSize is the largest JSON document a ConfigStore or ControlDispatcher accepts
+const MaxJSONSize = 16 << 10
+
+// defaultJSONWriteTimeout is how long a JSON write split across packets waits for its next packet
+const defaultJSONWriteTimeout = 5 * time.Second
+
+// ErrJSONWrite is returned for JSON writes that are too large or out of order
+var ErrJSONWrite = errors.New("invalid JSON write")
+
+// jsonAssembler collects JSON documents written across several packets, by sender,
+// until the packet with Push completes them. Each packet has to continue where the
+// last one ended, and writes that stall for longer than the timeout are dropped.
+type jsonAssembler struct {
+	mu      sync.Mutex
+	pending map[string]*partialJSON
+	timeout time.Duration // defaults to defaultJSONWriteTimeout
+}
+
+// partialJSON is a JSON write still waiting for its Push
+type partialJSON struct {
+	data    []byte
+	updated time.Time
+}
+
+// add adds packet to the document from addr, returning the document once it is complete
+func (a *jsonAssembler) add(packet *DDPPacket, addr *net.UDPAddr) ([]byte, bool, error) {
+	key := addr.String()
+	h := &packet.Header
+	now := time.Now()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	timeout := a.timeout
+	if timeout == 0 {
+		timeout = defaultJSONWriteTimeout
+	}
+	for k, p := range a.pending {
+		if now.Sub(p.updated) > timeout {
+			delete(a.pending, k)
+		}
+	}
+
+	// A write at offset 0 starts a new document
+	var data []byte
+	if p, exists := a.pending[key]; exists && h.Offset != 0 {
+		data = p.data
+	}
+	delete(a.pending, key)
+
+	if int64(h.Offset) != int64(len(data)) {
+		return nil, false, fmt.Errorf("%w: data at offset %d, expected %d", ErrJSONWrite, h.Offset, len(data))
+	}
+	if len(data)+len(packet.Data) > MaxJSONSize {
+		return nil, false, fmt.Errorf("%w: document larger than %d bytes", ErrJSONWrite, MaxJSONSize)
+	}
+	data = append(data, packet.Data...)
+
+	if h.F1.Push {
+		return data, true, nil
+	}
+
+	if a.pending == nil {
+		a.pending = make(map[string]*partialJSON)
+	}
+	a.pending[key] = &partialJSON{data: data, updated: now}
+	return nil, false, nil
+}
@@ -0,0 +1,188 @@
+package ddp
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// connectFakeDisplay connects a controller to a fake display answering queries with document
+func connectFakeDisplay(t *testing.T, document string) *DDPController {
+	t.Helper()
+
+	display := startFakeDisplay(t, func(query *DDPHeader) [][]byte {
+		// Split the document across two replies, sent out of order
+		half := len(document) / 2
+		return [][]byte{
+			replyPacket(query.ID, uint32(half), []byte(document[half:]), true),
+			replyPacket(query.ID, 0, []byte(document[:half]), false),
+		}
+	})
+
+	controller := NewDDPController()
+	if err := controller.ConnectUDP(display.LocalAddr().String()); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { controller.Close() })
+
+	return controller
+}
+
+// Test GetStatus parses a multi-packet status reply
+func TestGetStatus(t *testing.T) {
+	controller := connectFakeDisplay(t, `{"status":{"man":"Minleon","mod":"NDB","ver":"1.0","push":true}}`)
+
+	status, err := controller.GetStatus()
+	if err != nil {
+		t.Fatalf("GetStatus failed: %v", err)
+	}
+
+	expected := Status{Manufacturer: "Minleon", Model: "NDB", Version: "1.0", Push: true}
+	if *status != expected {
+		t.Errorf("Status = %+v, expected %+v", *status, expected)
+	}
+}
+
+// Test GetConfig parses ports
+func TestGetConfig(t *testing.T) {
+	controller := connectFakeDisplay(t, `{"config":{"ip":"10.0.1.9","nm":"255.255.255.0","gw":"10.0.1.1","ports":[{"port":1,"ts":2,"l":50,"ss":1},{"port":2,"ts":1,"l":100,"ss":151}]}}`)
+
+	config, err := controller.GetConfig()
+	if err != nil {
+		t.Fatalf("GetConfig failed: %v", err)
+	}
+
+	expected := Config{
+		IP:      "10.0.1.9",
+		Netmask: "255.255.255.0",
+		Gateway: "10.0.1.1",
+		Ports: []PortConfig{
+			{Port: 1, Ts: 2, Lights: 50, StartSlot: 1},
+			{Port: 2, Ts: 1, Lights: 100, StartSlot: 151},
+		},
+	}
+	if !reflect.DeepEqual(*config, expected) {
+		t.Errorf("Config = %+v, expected %+v", *config, expected)
+	}
+}
+
+// Test GetFavorites reads the favorites list from CONTROL
+func TestGetFavorites(t *testing.T) {
+	controller := connectFakeDisplay(t, `{"control":{"favorites":[{"i":1,"fx":"Multi Chaser","t":60,"int":100,"colors":[{"r":255,"g":0,"b":0}]},{"i":2,"fx":"Shift"}]}}`)
+
+	favorites, err := controller.GetFavorites()
+	if err != nil {
+		t.Fatalf("GetFavorites failed: %v", err)
+	}
+
+	expected := []Favorite{
+		{Index: 1, Effect: "Multi Chaser", Time: IntValue(60), Intensity: IntValue(100), Colors: []ControlColor{{R: 255}}},
+		{Index: 2, Effect: "Shift"},
+	}
+	if !reflect.DeepEqual(favorites, expected) {
+		t.Errorf("Favorites = %+v, expected %+v", favorites, expected)
+	}
+}
+
+// Test querying an unreadable JSON ID
+func TestGetStatusNotReadable(t *testing.T) {
+	controller := connectFakeDisplay(t, "")
+
+	if _, err := controller.GetStatus(); err == nil {
+		t.Error("GetStatus of an unreadable ID should fail")
+	}
+}
+
+// Test querying invalid JSON
+func TestGetConfigInvalidJSON(t *testing.T) {
+	controller := connectFakeDisplay(t, "{not json")
+
+	if _, err := controller.GetConfig(); err == nil {
+		t.Error("GetConfig with invalid JSON should fail")
+	}
+}
+
+// Test SetConfig writes the config document to the CONFIG ID
+func TestSetConfig(t *testing.T) {
+	controller, mock := newMockController()
+
+	err := controller.SetConfig(Config{Reboot: 1})
+	if err != nil {
+		t.Fatalf("SetConfig failed: %v", err)
+	}
+
+	packets := splitPackets(t, mock.data)
+	if len(packets) != 1 {
+		t.Fatalf("Packets = %d, expected 1", len(packets))
+	}
+	if packets[0].Header.ID != DDP_ID_CONFIG {
+		t.Errorf("ID = %d, expected %d", packets[0].Header.ID, DDP_ID_CONFIG)
+	}
+	if !packets[0].Header.F1.Push {
+		t.Error("Push flag should be set")
+	}
+	if string(packets[0].Data) != `{"config":{"reboot":1}}` {
+		t.Errorf("Data = %s, expected %s", packets[0].Data, `{"config":{"reboot":1}}`)
+	}
+}
+
+// Test SendControl splits large documents across packets
+func TestSendControlMultiPacket(t *testing.T) {
+	controller, mock := newMockController()
+
+	var favorites []Favorite
+	for i := 1; i <= 10; i++ {
+		favorites = append(favorites, Favorite{
+			Index:     i,
+			Effect:    "A rather long effect name to make the document bigger",
+			Time:      IntValue(32500),
+			Intensity: IntValue(100),
+			Speed:     IntValue(50),
+			Direction: IntValue(0),
+			Colors:    []ControlColor{{R: 255}, {G: 255}, {B: 255}},
+		})
+	}
+	control := Control{Favorites: favorites}
+
+	if err := controller.SendControl(control); err != nil {
+		t.Fatalf("SendControl failed: %v", err)
+	}
+
+	packets := splitPackets(t, mock.data)
+	if len(packets) < 2 {
+		t.Fatalf("Packets = %d, expected more than 1", len(packets))
+	}
+
+	var data []byte
+	for i, p := range packets {
+		if p.Header.ID != DDP_ID_CONTROL {
+			t.Errorf("Packet %d ID = %d, expected %d", i, p.Header.ID, DDP_ID_CONTROL)
+		}
+		if int(p.Header.Offset) != len(data) {
+			t.Errorf("Packet %d offset = %d, expected %d", i, p.Header.Offset, len(data))
+		}
+		if p.Header.F1.Push != (i == len(packets)-1) {
+			t.Errorf("Packet %d push = %v", i, p.Header.F1.Push)
+		}
+		data = append(data, p.Data...)
+	}
+
+	var doc controlDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Invalid JSON written: %v", err)
+	}
+	if !reflect.DeepEqual(doc.Control, control) {
+		t.Errorf("Control = %+v, expected %+v", doc.Control, control)
+	}
+}
+
+// Test Control encodes zero values that are set
+func TestControlZeroValues(t *testing.T) {
+	data, err := json.Marshal(Control{Power: IntValue(0)})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(data) != `{"power":0}` {
+		t.Errorf("Control = %s, expected %s", data, `{"power":0}`)
+	}
+}
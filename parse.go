@@ -0,0 +1,105 @@
+package ddp
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Problems found when validating a packet, wrapped with details.
+// Use errors.Is to tell them apart.
+var (
+	ErrVersion        = errors.New("unsupported protocol version")
+	ErrReservedBits   = errors.New("reserved bits set")
+	ErrSequence       = errors.New("sequence number out of range")
+	ErrTruncated      = fmt.Errorf("%w: payload shorter than Length", ErrPayloadMismatch)
+	ErrOversizeLength = errors.New("Length exceeds maximum data length")
+	ErrQueryWithData  = errors.New("query carries data")
+)
+
+const (
+	flagReserved     byte = 0x20 // x bit of the flags byte
+	sequenceReserved byte = 0xf0 // upper nibble of the sequence byte
+	dataTypeReserved byte = 0x40 // R bit of the data type byte
+)
+
+// ParseMode controls how ParseDDPPacket treats packets that break the spec
+type ParseMode int
+
+const (
+	// ParseLenient accepts any packet with a whole header and reports problems as warnings
+	ParseLenient ParseMode = iota
+	// ParseStrict rejects packets with any problem
+	ParseStrict
+)
+
+// ValidateDDPPacket checks a raw packet against the spec and returns the problems
+// found. Queries may ask for any Length but carry no data, except STATUS queries
+// which can carry a JSON request.
+func ValidateDDPPacket(data []byte) []error {
+	header, headerSize, err := ParseDDPHeader(data)
+	if err != nil {
+		return []error{err}
+	}
+
+	var problems []error
+
+	if version := data[0] & flagVersionMask; version != flagVersion1 {
+		problems = append(problems, fmt.Errorf("%w: version %d", ErrVersion, version>>6))
+	}
+	if data[0]&flagReserved != 0 {
+		problems = append(problems, fmt.Errorf("%w: flags 0x%02X", ErrReservedBits, data[0]))
+	}
+	if data[1]&sequenceReserved != 0 {
+		problems = append(problems, fmt.Errorf("%w: %d", ErrSequence, data[1]))
+	}
+	if data[2]&dataTypeReserved != 0 {
+		problems = append(problems, fmt.Errorf("%w: data type 0x%02X", ErrReservedBits, data[2]))
+	}
+
+	payload := len(data) - headerSize
+	if header.F1.Query && !header.F1.Reply {
+		if payload > 0 && header.ID != DDP_ID_STATUS {
+			problems = append(problems, fmt.Errorf("%w: %d bytes", ErrQueryWithData, payload))
+		}
+		return problems
+	}
+
+	if header.Length > DDP_MAX_DATALEN {
+		problems = append(problems, fmt.Errorf("%w: %d bytes", ErrOversizeLength, header.Length))
+	}
+	if payload < int(header.Length) {
+		problems = append(problems, fmt.Errorf("%w: expected %d bytes, got %d", ErrTruncated, header.Length, payload))
+	}
+
+	return problems
+}
+
+// ParseDDPPacket parses a header and its payload. In ParseStrict mode the first
+// problem found by ValidateDDPPacket is returned as the error. In ParseLenient mode
+// the problems are returned as warnings along with the packet, whose payload is
+// whatever data arrived up to Length. The payload of a query is whatever follows
+// the header, as its Length is how much to read. Data points into data.
+func ParseDDPPacket(data []byte, mode ParseMode) (*DDPPacket, []error, error) {
+	header, headerSize, err := ParseDDPHeader(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	problems := ValidateDDPPacket(data)
+	if mode == ParseStrict && len(problems) > 0 {
+		return nil, nil, problems[0]
+	}
+
+	payload := data[headerSize:]
+	if !(header.F1.Query && !header.F1.Reply) && len(payload) > int(header.Length) {
+		payload = payload[:header.Length]
+	}
+
+	return &DDPPacket{Header: *header, Data: payload}, problems, nil
+}
+
+// SetParseMode sets how the server treats packets that break the spec, defaults
+// to ParseLenient which logs the problems and handles the packet anyway
+func (s *DDPServer) SetParseMode(mode ParseMode) {
+	s.parseMode = mode
+}
@@ -0,0 +1,87 @@
+package ddp
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+// Test each kind of problem is found and rejected in strict mode
+func TestParseDDPPacketStrict(t *testing.T) {
+	valid := DDPHeader{F1: ConfigFlag{Push: true}, SequenceNumber: 3, DataType: PixelDataType{RGB, Pixel8Bits, false}, ID: 1, Length: 3}
+	packet := append(valid.Bytes(), 1, 2, 3)
+
+	tests := []struct {
+		name     string
+		modify   func(p []byte) []byte
+		expected error
+	}{
+		{"wrong version", func(p []byte) []byte { p[0] = p[0]&^flagVersionMask | 0x80; return p }, ErrVersion},
+		{"reserved flag bit", func(p []byte) []byte { p[0] |= flagReserved; return p }, ErrReservedBits},
+		{"reserved data type bit", func(p []byte) []byte { p[2] |= dataTypeReserved; return p }, ErrReservedBits},
+		{"sequence over 15", func(p []byte) []byte { p[1] = 16; return p }, ErrSequence},
+		{"truncated payload", func(p []byte) []byte { return p[:len(p)-1] }, ErrTruncated},
+		{"oversize length", func(p []byte) []byte { p[8], p[9] = 0x05, 0xA1; return p }, ErrOversizeLength},
+		{"query with data", func(p []byte) []byte { p[0] |= flagQuery; return p }, ErrQueryWithData},
+	}
+
+	if _, _, err := ParseDDPPacket(packet, ParseStrict); err != nil {
+		t.Fatalf("Valid packet rejected: %v", err)
+	}
+
+	for _, tt := range tests {
+		p := tt.modify(append([]byte(nil), packet...))
+
+		_, _, err := ParseDDPPacket(p, ParseStrict)
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("%s: error = %v, expected %v", tt.name, err, tt.expected)
+		}
+
+		// Lenient mode keeps the packet and reports the same problem
+		parsed, warnings, err := ParseDDPPacket(p, ParseLenient)
+		if err != nil || parsed == nil {
+			t.Errorf("%s: lenient parse failed: %v", tt.name, err)
+			continue
+		}
+		if len(warnings) == 0 || !errors.Is(warnings[0], tt.expected) {
+			t.Errorf("%s: warnings = %v, expected %v", tt.name, warnings, tt.expected)
+		}
+	}
+}
+
+// Test queries may ask for more than they carry, and STATUS queries may carry a request
+func TestParseDDPPacketQuery(t *testing.T) {
+	query := DDPHeader{F1: ConfigFlag{Query: true}, ID: 1, Length: 5000}
+	if _, _, err := ParseDDPPacket(query.Bytes(), ParseStrict); err != nil {
+		t.Errorf("Query rejected: %v", err)
+	}
+
+	status := DDPHeader{F1: ConfigFlag{Query: true}, ID: DDP_ID_STATUS}
+	packet, _, err := ParseDDPPacket(append(status.Bytes(), `{"mac":"*"}`...), ParseStrict)
+	if err != nil {
+		t.Fatalf("STATUS query with a request rejected: %v", err)
+	}
+	if string(packet.Data) != `{"mac":"*"}` {
+		t.Errorf("Data = %q, expected the request", packet.Data)
+	}
+}
+
+// Test the server drops bad packets in strict mode
+func TestServerParseMode(t *testing.T) {
+	server := NewDDPServer()
+	server.SetParseMode(ParseStrict)
+
+	received := 0
+	server.RegisterHandler(1, func(packet *DDPPacket, addr *net.UDPAddr) error {
+		received++
+		return nil
+	})
+
+	h := DDPHeader{F1: ConfigFlag{Push: true}, ID: 1, Length: 3}
+	server.handlePacket(append(h.Bytes(), 1, 2, 3), testAddr)
+	server.handlePacket(append(h.Bytes(), 1, 2), testAddr)
+
+	if received != 1 {
+		t.Errorf("Received %d packets, expected only the valid one", received)
+	}
+}
@@ -0,0 +1,374 @@
+package ddp
+
+import (
+	"context"
+	"fmt"
+	"image/color"
+	"math"
+)
+
+// RGBW64 is a color with a separate white channel, 16 bits per channel like color.RGBA64.
+// Displays without a white channel see it added to the other channels.
+type RGBW64 struct {
+	R, G, B, W uint16
+}
+
+// RGBA implements color.Color
+func (c RGBW64) RGBA() (r, g, b, a uint32) {
+	add := func(v uint16) uint32 {
+		sum := uint32(v) + uint32(c.W)
+		if sum > 0xFFFF {
+			return 0xFFFF
+		}
+		return sum
+	}
+	return add(c.R), add(c.G), add(c.B), 0xFFFF
+}
+
+// HSLColor is a color as hue in degrees [0, 360), and saturation and lightness in [0, 1]
+type HSLColor struct {
+	H, S, L float64
+}
+
+// RGBA implements color.Color
+func (c HSLColor) RGBA() (r, g, b, a uint32) {
+	h := math.Mod(c.H, 360)
+	if h < 0 {
+		h += 360
+	}
+	s, l := clampUnit(c.S), clampUnit(c.L)
+
+	chroma := (1 - math.Abs(2*l-1)) * s
+	x := chroma * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := l - chroma/2
+
+	var rf, gf, bf float64
+	switch {
+	case h < 60:
+		rf, gf, bf = chroma, x, 0
+	case h < 120:
+		rf, gf, bf = x, chroma, 0
+	case h < 180:
+		rf, gf, bf = 0, chroma, x
+	case h < 240:
+		rf, gf, bf = 0, x, chroma
+	case h < 300:
+		rf, gf, bf = x, 0, chroma
+	default:
+		rf, gf, bf = chroma, 0, x
+	}
+
+	return unitTo16(rf + m), unitTo16(gf + m), unitTo16(bf + m), 0xFFFF
+}
+
+// hslFromColor converts any color to HSL
+func hslFromColor(c color.Color) HSLColor {
+	if hsl, ok := c.(HSLColor); ok {
+		return hsl
+	}
+
+	r16, g16, b16, _ := c.RGBA()
+	r, g, b := float64(r16)/0xFFFF, float64(g16)/0xFFFF, float64(b16)/0xFFFF
+
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	l := (max + min) / 2
+	if max == min {
+		return HSLColor{0, 0, l}
+	}
+
+	d := max - min
+	s := d / (1 - math.Abs(2*l-1))
+
+	var h float64
+	switch max {
+	case r:
+		h = math.Mod((g-b)/d, 6)
+	case g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+	h *= 60
+	if h < 0 {
+		h += 360
+	}
+
+	return HSLColor{h, clampUnit(s), l}
+}
+
+func clampUnit(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+func unitTo16(v float64) uint32 {
+	return uint32(math.Round(clampUnit(v) * 0xFFFF))
+}
+
+// elementBits returns the size in bits of each element of a pixel, 0 if undefined
+func (p *PixelDataType) elementBits() int {
+	switch p.DataSize {
+	case Pixel1Bits:
+		return 1
+	case Pixel4Bits:
+		return 4
+	case Pixel8Bits:
+		return 8
+	case Pixel16Bits:
+		return 16
+	case Pixel24Bits:
+		return 24
+	case Pixel32Bits:
+		return 32
+	}
+	return 0
+}
+
+// elementsPerPixel returns the number of elements in a pixel, 0 if undefined
+func (p *PixelDataType) elementsPerPixel() int {
+	switch p.DataType {
+	case RGB, HSL:
+		return 3
+	case RGBW:
+		return 4
+	case Grayscale:
+		return 1
+	}
+	return 0
+}
+
+// checkEncodable reports if pixels of this data type can be encoded and decoded
+func (p *PixelDataType) checkEncodable() error {
+	if p.CustomerDefined {
+		return fmt.Errorf("customer defined data type 0x%02X can't be encoded", p.Byte())
+	}
+	if p.elementBits() == 0 || p.elementsPerPixel() == 0 {
+		return fmt.Errorf("undefined data type 0x%02X can't be encoded", p.Byte())
+	}
+	return nil
+}
+
+// elements returns the elements of c for a data type, scaled to 16 bits
+func elements(t LEDDataType, c color.Color) []uint16 {
+	switch t {
+	case RGB:
+		r, g, b, _ := c.RGBA()
+		return []uint16{uint16(r), uint16(g), uint16(b)}
+	case RGBW:
+		if w, ok := c.(RGBW64); ok {
+			return []uint16{w.R, w.G, w.B, w.W}
+		}
+		r, g, b, _ := c.RGBA()
+		return []uint16{uint16(r), uint16(g), uint16(b), 0}
+	case HSL:
+		hsl := hslFromColor(c)
+		hue := math.Mod(hsl.H, 360)
+		if hue < 0 {
+			hue += 360
+		}
+		return []uint16{uint16(unitTo16(hue / 360)), uint16(unitTo16(hsl.S)), uint16(unitTo16(hsl.L))}
+	case Grayscale:
+		return []uint16{color.Gray16Model.Convert(c).(color.Gray16).Y}
+	}
+	return nil
+}
+
+// colorFromElements builds a color from elements scaled to 16 bits
+func colorFromElements(t LEDDataType, e []uint16) color.Color {
+	switch t {
+	case RGB:
+		return color.RGBA64{e[0], e[1], e[2], 0xFFFF}
+	case RGBW:
+		return RGBW64{e[0], e[1], e[2], e[3]}
+	case HSL:
+		return HSLColor{float64(e[0]) / 0xFFFF * 360, float64(e[1]) / 0xFFFF, float64(e[2]) / 0xFFFF}
+	case Grayscale:
+		return color.Gray16{e[0]}
+	}
+	return nil
+}
+
+// scaleFrom16 scales a 16-bit value to bits, repeating its bits to fill wider elements
+func scaleFrom16(v uint16, bits int) uint32 {
+	switch {
+	case bits <= 16:
+		return uint32(v) >> (16 - bits)
+	case bits == 24:
+		return uint32(v)<<8 | uint32(v)>>8
+	default:
+		return uint32(v)<<16 | uint32(v)
+	}
+}
+
+// scaleTo16 scales a value of bits to 16 bits, repeating its bits to fill narrower elements
+func scaleTo16(v uint32, bits int) uint16 {
+	switch bits {
+	case 1:
+		return uint16(v * 0xFFFF)
+	case 4:
+		return uint16(v * 0x1111)
+	case 8:
+		return uint16(v * 0x0101)
+	default:
+		return uint16(v >> (bits - 16))
+	}
+}
+
+// EncodePixels packs colors into pixel data of the given data type.
+// Elements are big-endian; 1 and 4 bit elements are packed most significant bit
+// first, with the last byte padded with zeros.
+func EncodePixels(dataType PixelDataType, pixels []color.Color) ([]byte, error) {
+	if err := dataType.checkEncodable(); err != nil {
+		return nil, err
+	}
+
+	bits := dataType.elementBits()
+	data := make([]byte, 0, (len(pixels)*dataType.elementsPerPixel()*bits+7)/8)
+
+	var acc uint64 // bits not yet written out
+	var pending int
+	for _, c := range pixels {
+		for _, e := range elements(dataType.DataType, c) {
+			acc = acc<<bits | uint64(scaleFrom16(e, bits))
+			pending += bits
+			for pending >= 8 {
+				pending -= 8
+				data = append(data, byte(acc>>pending))
+			}
+			acc &= 1<<pending - 1
+		}
+	}
+	if pending > 0 {
+		data = append(data, byte(acc<<(8-pending)))
+	}
+
+	return data, nil
+}
+
+// DecodePixels unpacks pixel data of the given data type into colors: color.RGBA64
+// for RGB, RGBW64, HSLColor and color.Gray16 for grayscale. Padding in the last byte
+// is ignored, but data that ends partway through a pixel is an error. With 1 and 4 bit
+// elements padding can't always be told apart from black pixels, and decodes as such.
+func DecodePixels(dataType PixelDataType, data []byte) ([]color.Color, error) {
+	if err := dataType.checkEncodable(); err != nil {
+		return nil, err
+	}
+
+	bits := dataType.elementBits()
+	perPixel := dataType.elementsPerPixel()
+	count := len(data) * 8 / (bits * perPixel)
+	if len(data)*8-count*bits*perPixel >= 8 {
+		return nil, fmt.Errorf("%d bytes is not a whole number of %d bit pixels", len(data), bits*perPixel)
+	}
+
+	pixels := make([]color.Color, 0, count)
+	e := make([]uint16, perPixel)
+
+	var acc uint64 // bits read but not yet used
+	var pending int
+	next := 0
+	for len(pixels) < count {
+		for i := range e {
+			for pending < bits {
+				acc = acc<<8 | uint64(data[next])
+				next++
+				pending += 8
+			}
+			pending -= bits
+			e[i] = scaleTo16(uint32(acc>>pending)&(1<<bits-1), bits)
+			acc &= 1<<pending - 1
+		}
+		pixels = append(pixels, colorFromElements(dataType.DataType, e))
+	}
+
+	return pixels, nil
+}
+
+// Pixels decodes the packet's data using the data type in its header, see DecodePixels
+func (p *DDPPacket) Pixels() ([]color.Color, error) {
+	return DecodePixels(p.Header.DataType, p.Data)
+}
+
+// WritePixels encodes pixels using the data type of the default header and writes
+// them as a frame, see WriteFrame. Returns the number of bytes written.
+func (c *DDPController) WritePixels(pixels []color.Color) (int, error) {
+	return c.WritePixelsContext(context.Background(), pixels)
+}
+
+// WritePixelsContext is WritePixels, stopping before the next packet if ctx is done
+func (c *DDPController) WritePixelsContext(ctx context.Context, pixels []color.Color) (int, error) {
+	data, err := EncodePixels(c.currentHeader().DataType, pixels)
+	if err != nil {
+		return 0, err
+	}
+	return c.WriteFrameContext(ctx, data)
+}
+
+// DataTypeProfile says how the data type field of a header is read
+type DataTypeProfile int
+
+const (
+	// StrictDataType reads SSS as bits per pixel element as the spec says,
+	// so 8-bit RGB is RGB with Pixel8Bits (0x0B) and takes 3 bytes per pixel
+	StrictDataType DataTypeProfile = iota
+	// WLEDDataType reads the data type like WLED does: elements are always 8 bits and
+	// SSS is ignored, RGBW pixels are 4 bytes and any other defined type is 3 bytes
+	// of RGB. An undefined type, as JSON and DMX packets use, has no pixel size.
+	// WLED itself sends 0x0B and 0x1B, so senders following the spec also suit WLED.
+	WLEDDataType
+)
+
+// BitsPerPixel returns the number of bits in a pixel of this data type as read by
+// profile, or 0 if the data type leaves it undefined
+func (p *PixelDataType) BitsPerPixel(profile DataTypeProfile) int {
+	if profile == WLEDDataType {
+		if p.DataType == UndefinedType {
+			return 0
+		}
+		if p.DataType == RGBW {
+			return 32
+		}
+		return 24
+	}
+
+	if p.CustomerDefined {
+		return 0
+	}
+	return p.elementBits() * p.elementsPerPixel()
+}
+
+// BytesPerPixel returns the number of bytes in a pixel of this data type as read by
+// profile, or 0 if it is undefined or pixels don't take a whole number of bytes
+func (p *PixelDataType) BytesPerPixel(profile DataTypeProfile) int {
+	bits := p.BitsPerPixel(profile)
+	if bits%8 != 0 {
+		return 0
+	}
+	return bits / 8
+}
+
+// SetDataTypeCheck makes the server drop pixel data whose Length is not a whole
+// number of pixels of the packet's data type as read by profile. Only display IDs
+// and DDP_ID_ALL carry pixels, so JSON and DMX packets aren't checked, nor are
+// packets without a defined whole-byte pixel size, queries, replies and storage packets.
+func (s *DDPServer) SetDataTypeCheck(profile DataTypeProfile) {
+	s.checkDataType = true
+	s.dataTypeProfile = profile
+}
+
+// checkPixelLength returns an error if a packet's Length is not a whole number of pixels
+func (s *DDPServer) checkPixelLength(h *DDPHeader) error {
+	if !s.checkDataType || h.F1.Query || h.F1.Reply || h.F1.Storage {
+		return nil
+	}
+	if !isDisplayID(h.ID) && h.ID != DDP_ID_ALL {
+		return nil
+	}
+
+	size := h.DataType.BytesPerPixel(s.dataTypeProfile)
+	if size == 0 || int(h.Length)%size == 0 {
+		return nil
+	}
+	return fmt.Errorf("length %d is not a multiple of the %d byte pixel size of data type 0x%02X",
+		h.Length, size, h.DataType.Byte())
+}
@@ -0,0 +1,242 @@
+package ddp
+
+import (
+	"bytes"
+	"image/color"
+	"math"
+	"net"
+	"testing"
+)
+
+// Test the byte layout of each element size
+func TestEncodePixelsLayout(t *testing.T) {
+	red := color.RGBA64{0xFFFF, 0, 0, 0xFFFF}
+	grey := color.RGBA64{0x1234, 0x1234, 0x1234, 0xFFFF}
+
+	tests := []struct {
+		name     string
+		dataType PixelDataType
+		pixels   []color.Color
+		expected []byte
+	}{
+		{"RGB 8 bit", PixelDataType{RGB, Pixel8Bits, false}, []color.Color{red, color.RGBA{1, 2, 3, 255}},
+			[]byte{0xFF, 0, 0, 1, 2, 3}},
+		{"RGB 16 bit", PixelDataType{RGB, Pixel16Bits, false}, []color.Color{color.RGBA64{0x1234, 0x5678, 0x9ABC, 0xFFFF}},
+			[]byte{0x12, 0x34, 0x56, 0x78, 0x9A, 0xBC}},
+		{"Grayscale 24 bit", PixelDataType{Grayscale, Pixel24Bits, false}, []color.Color{color.Gray16{0x1234}},
+			[]byte{0x12, 0x34, 0x12}},
+		{"Grayscale 32 bit", PixelDataType{Grayscale, Pixel32Bits, false}, []color.Color{color.Gray16{0x1234}},
+			[]byte{0x12, 0x34, 0x12, 0x34}},
+		{"RGB 1 bit", PixelDataType{RGB, Pixel1Bits, false}, []color.Color{red, color.White, color.Black},
+			[]byte{0b10011100, 0b00000000}},
+		{"Grayscale 4 bit", PixelDataType{Grayscale, Pixel4Bits, false}, []color.Color{grey, color.White, color.Black},
+			[]byte{0x1F, 0x00}},
+		{"RGBW 8 bit", PixelDataType{RGBW, Pixel8Bits, false}, []color.Color{RGBW64{0, 0x8080, 0, 0xFFFF}, red},
+			[]byte{0, 0x80, 0, 0xFF, 0xFF, 0, 0, 0}},
+		{"HSL 8 bit", PixelDataType{HSL, Pixel8Bits, false}, []color.Color{HSLColor{180, 1, 0.5}, red},
+			[]byte{0x80, 0xFF, 0x80, 0, 0xFF, 0x80}},
+	}
+
+	for _, tt := range tests {
+		data, err := EncodePixels(tt.dataType, tt.pixels)
+		if err != nil {
+			t.Errorf("%s: EncodePixels failed: %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(data, tt.expected) {
+			t.Errorf("%s: EncodePixels = %08b, expected %08b", tt.name, data, tt.expected)
+		}
+	}
+}
+
+// Test every data type and size decodes back to what was encoded
+func TestPixelsRoundtrip(t *testing.T) {
+	types := []LEDDataType{RGB, HSL, RGBW, Grayscale}
+	sizes := []LEDPixelFormat{Pixel1Bits, Pixel4Bits, Pixel8Bits, Pixel16Bits, Pixel24Bits, Pixel32Bits}
+
+	// Full scale and zero elements survive every size
+	pixels := map[LEDDataType][]color.Color{
+		RGB:       {color.RGBA64{0xFFFF, 0, 0xFFFF, 0xFFFF}, color.RGBA64{0, 0xFFFF, 0, 0xFFFF}},
+		HSL:       {HSLColor{0, 1, 0}, HSLColor{0, 0, 1}},
+		RGBW:      {RGBW64{0xFFFF, 0, 0, 0xFFFF}, RGBW64{0, 0xFFFF, 0xFFFF, 0}},
+		Grayscale: {color.Gray16{0xFFFF}, color.Gray16{0}, color.Gray16{0xFFFF}},
+	}
+
+	for _, typ := range types {
+		for _, size := range sizes {
+			dataType := PixelDataType{typ, size, false}
+			data, err := EncodePixels(dataType, pixels[typ])
+			if err != nil {
+				t.Errorf("Type %d size %d: EncodePixels failed: %v", typ, size, err)
+				continue
+			}
+
+			decoded, err := DecodePixels(dataType, data)
+			if err != nil {
+				t.Errorf("Type %d size %d: DecodePixels failed: %v", typ, size, err)
+				continue
+			}
+			if len(decoded) < len(pixels[typ]) {
+				t.Errorf("Type %d size %d: decoded %d pixels, expected %d", typ, size, len(decoded), len(pixels[typ]))
+				continue
+			}
+			for i, expected := range pixels[typ] {
+				if decoded[i] != expected {
+					t.Errorf("Type %d size %d: pixel %d = %v, expected %v", typ, size, i, decoded[i], expected)
+				}
+			}
+		}
+	}
+}
+
+// Test 16 bit elements keep their full precision
+func TestDecodePixels16Bit(t *testing.T) {
+	dataType := PixelDataType{RGB, Pixel16Bits, false}
+	pixels, err := DecodePixels(dataType, []byte{0x12, 0x34, 0x56, 0x78, 0x9A, 0xBC})
+	if err != nil {
+		t.Fatalf("DecodePixels failed: %v", err)
+	}
+
+	expected := color.RGBA64{0x1234, 0x5678, 0x9ABC, 0xFFFF}
+	if len(pixels) != 1 || pixels[0] != expected {
+		t.Errorf("DecodePixels = %v, expected [%v]", pixels, expected)
+	}
+}
+
+// Test data that isn't a whole number of pixels or has no defined type is refused
+func TestDecodePixelsInvalid(t *testing.T) {
+	if _, err := DecodePixels(PixelDataType{RGB, Pixel8Bits, false}, []byte{1, 2, 3, 4}); err == nil {
+		t.Error("Expected error for a partial RGB pixel")
+	}
+	if _, err := DecodePixels(PixelDataType{RGBW, Pixel4Bits, false}, []byte{1, 2, 3}); err == nil {
+		t.Error("Expected error for a partial 4 bit RGBW pixel")
+	}
+	if _, err := DecodePixels(PixelDataType{UndefinedType, Pixel8Bits, false}, []byte{1}); err == nil {
+		t.Error("Expected error for an undefined data type")
+	}
+	if _, err := EncodePixels(PixelDataType{RGB, UndefinedPixelFormat, false}, []color.Color{color.White}); err == nil {
+		t.Error("Expected error for an undefined pixel size")
+	}
+	if _, err := EncodePixels(PixelDataType{RGB, Pixel8Bits, true}, []color.Color{color.White}); err == nil {
+		t.Error("Expected error for a customer defined data type")
+	}
+}
+
+// Test HSL converts to and from RGB
+func TestHSLColor(t *testing.T) {
+	r, g, b, _ := HSLColor{120, 1, 0.5}.RGBA()
+	if r != 0 || g != 0xFFFF || b != 0 {
+		t.Errorf("HSL(120, 1, 0.5) = %04X %04X %04X, expected pure green", r, g, b)
+	}
+
+	hsl := hslFromColor(color.RGBA{0, 0, 255, 255})
+	if math.Abs(hsl.H-240) > 0.01 || math.Abs(hsl.S-1) > 0.01 || math.Abs(hsl.L-0.5) > 0.01 {
+		t.Errorf("Blue = %+v, expected HSL(240, 1, 0.5)", hsl)
+	}
+}
+
+// Test WritePixels encodes with the header's data type
+func TestWritePixels(t *testing.T) {
+	controller, mock := newMockController()
+	h := DefaultDDPHeader()
+	h.DataType = PixelDataType{Grayscale, Pixel8Bits, false}
+	controller.SetDefaultHeader(h)
+
+	if _, err := controller.WritePixels([]color.Color{color.Gray{10}, color.Gray{20}}); err != nil {
+		t.Fatalf("WritePixels failed: %v", err)
+	}
+
+	packets := splitPackets(t, mock.data)
+	if len(packets) != 1 {
+		t.Fatalf("Got %d packets, expected 1", len(packets))
+	}
+	if !bytes.Equal(packets[0].Data, []byte{10, 20}) {
+		t.Errorf("Data = %v, expected [10 20]", packets[0].Data)
+	}
+
+	// Packets decode back with the data type from their header
+	pixels, err := packets[0].Pixels()
+	if err != nil {
+		t.Fatalf("Pixels failed: %v", err)
+	}
+	if len(pixels) != 2 || pixels[1] != (color.Gray16{20 * 0x0101}) {
+		t.Errorf("Pixels = %v, expected two gray pixels", pixels)
+	}
+}
+
+// Test the pixel size implied by each profile
+func TestBytesPerPixel(t *testing.T) {
+	tests := []struct {
+		dataType PixelDataType
+		strict   int
+		wled     int
+	}{
+		{PixelDataType{RGB, Pixel8Bits, false}, 3, 3},
+		{PixelDataType{RGB, Pixel24Bits, false}, 9, 3}, // per-pixel size misread as per-element
+		{PixelDataType{RGB, Pixel16Bits, false}, 6, 3},
+		{PixelDataType{RGBW, Pixel8Bits, false}, 4, 4},
+		{PixelDataType{Grayscale, Pixel8Bits, false}, 1, 3},
+		{PixelDataType{RGB, Pixel4Bits, false}, 0, 3}, // 12 bits is not whole bytes
+		{PixelDataType{UndefinedType, UndefinedPixelFormat, false}, 0, 0},
+		{PixelDataType{UndefinedType, Pixel8Bits, false}, 0, 0},
+	}
+
+	for _, tt := range tests {
+		if got := tt.dataType.BytesPerPixel(StrictDataType); got != tt.strict {
+			t.Errorf("Strict BytesPerPixel(0x%02X) = %d, expected %d", tt.dataType.Byte(), got, tt.strict)
+		}
+		if got := tt.dataType.BytesPerPixel(WLEDDataType); got != tt.wled {
+			t.Errorf("WLED BytesPerPixel(0x%02X) = %d, expected %d", tt.dataType.Byte(), got, tt.wled)
+		}
+	}
+
+	rgb4 := PixelDataType{RGB, Pixel4Bits, false}
+	if bits := rgb4.BitsPerPixel(StrictDataType); bits != 12 {
+		t.Errorf("BitsPerPixel(0x%02X) = %d, expected 12", rgb4.Byte(), bits)
+	}
+}
+
+// Test the server drops pixel data that isn't a whole number of pixels
+func TestServerDataTypeCheck(t *testing.T) {
+	server := NewDDPServer()
+	server.SetDataTypeCheck(StrictDataType)
+
+	var received [][]byte
+	server.RegisterHandler(1, func(packet *DDPPacket, addr *net.UDPAddr) error {
+		received = append(received, append([]byte(nil), packet.Data...))
+		return nil
+	})
+
+	controller, mock := newMockController()
+	controller.Write([]byte{1, 2, 3, 4, 5, 6})
+	controller.Write([]byte{1, 2, 3, 4})
+	feedServer(t, server, mock)
+
+	if len(received) != 1 || len(received[0]) != 6 {
+		t.Errorf("Received %v, expected only the 6 byte packet", received)
+	}
+}
+
+// Test the WLED check leaves JSON writes alone
+func TestServerDataTypeCheckJSON(t *testing.T) {
+	store := NewConfigStore()
+
+	server := NewDDPServer()
+	server.SetDispatchMode(DispatchOrdered)
+	server.SetDataTypeCheck(WLEDDataType)
+	server.RegisterConfigStore(store)
+	controller := newQueryServer(t, server)
+
+	// 28 bytes, not a multiple of 3
+	if err := controller.SetConfig(Config{IP: "10.0.0.5"}); err != nil {
+		t.Fatalf("SetConfig failed: %v", err)
+	}
+
+	config, err := controller.GetConfig()
+	if err != nil {
+		t.Fatalf("GetConfig failed: %v", err)
+	}
+	if config.IP != "10.0.0.5" {
+		t.Errorf("IP = %q, expected the write to be stored", config.IP)
+	}
+}
@@ -0,0 +1,28 @@
+package ddp
+
+import "sync"
+
+// maxPacketSize is the largest UDP payload
+const maxPacketSize = 65507
+
+// packetBuffer holds a single received packet. It is owned by the goroutine
+// handling the packet until release returns it to the pool.
+type packetBuffer struct {
+	data [maxPacketSize]byte
+}
+
+var packetPool = sync.Pool{
+	New: func() interface{} {
+		return new(packetBuffer)
+	},
+}
+
+// getPacketBuffer takes a buffer from the pool
+func getPacketBuffer() *packetBuffer {
+	return packetPool.Get().(*packetBuffer)
+}
+
+// release returns the buffer to the pool, it must not be used afterwards
+func (pb *packetBuffer) release() {
+	packetPool.Put(pb)
+}
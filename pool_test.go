@@ -0,0 +1,94 @@
+package ddp
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test packet data stays intact while later packets are received
+func TestDDPServerPacketDataStable(t *testing.T) {
+	server := NewDDPServer()
+
+	const packets = 50
+
+	var wg sync.WaitGroup
+	wg.Add(packets)
+	corrupted := make(chan uint32, packets)
+
+	server.RegisterHandler(1, func(packet *DDPPacket, addr *net.UDPAddr) error {
+		defer wg.Done()
+
+		// Hold on to the data while more packets arrive
+		expected := bytes.Repeat([]byte{byte(packet.Header.Offset)}, len(packet.Data))
+		time.Sleep(20 * time.Millisecond)
+
+		if !bytes.Equal(packet.Data, expected) {
+			corrupted <- packet.Header.Offset
+		}
+		return nil
+	})
+
+	go func() {
+		if err := server.Listen("127.0.0.1:0"); err != nil {
+			t.Logf("Server error: %v", err)
+		}
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	defer server.Close()
+
+	controller := NewDDPController()
+	if err := controller.ConnectUDP(server.Addr().String()); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer controller.Close()
+
+	for i := 0; i < packets; i++ {
+		if _, err := controller.WriteOffset(bytes.Repeat([]byte{byte(i)}, 300), uint32(i)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for packets")
+	}
+
+	close(corrupted)
+	for offset := range corrupted {
+		t.Errorf("Packet %d was overwritten while its handler ran", offset)
+	}
+}
+
+// Benchmark the receive path from a pooled buffer through to the handler
+func BenchmarkServerHandleBuffer(b *testing.B) {
+	server := NewDDPServer()
+	server.RegisterHandler(1, func(packet *DDPPacket, addr *net.UDPAddr) error {
+		return nil
+	})
+
+	h := DefaultDDPHeader()
+	h.Length = DDP_MAX_DATALEN
+	raw := append(h.Bytes(), make([]byte, DDP_MAX_DATALEN)...)
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: DDP_PORT}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(raw)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		pb := getPacketBuffer()
+		n := copy(pb.data[:], raw)
+		server.handleBuffer(pb, n, addr)
+	}
+}
@@ -0,0 +1,79 @@
+package ddp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+)
+
+// DocumentFunc returns the current contents of a readable ID
+type DocumentFunc func() ([]byte, error)
+
+// RegisterDocument makes id readable: Queries for it are answered from whatever
+// document returns at the time. Writes to id still go to its packet handler.
+func (s *DDPServer) RegisterDocument(id byte, document DocumentFunc) {
+	s.documents[id] = document
+}
+
+// RegisterJSON makes id readable as the JSON encoding of the value returned by
+// value, see RegisterDocument
+func (s *DDPServer) RegisterJSON(id byte, value func() interface{}) {
+	s.RegisterDocument(id, func() ([]byte, error) {
+		return json.Marshal(value())
+	})
+}
+
+// answerQuery replies to a Query from the ID's frame buffer or document, or with
+// an empty Reply if nothing can answer it. Returns false if the query should go to
+// a handler registered for the ID, which then answers it itself. The default handler
+// doesn't get queries, so unreadable IDs still get their empty Reply.
+func (s *DDPServer) answerQuery(packet *DDPPacket, addr *net.UDPAddr) bool {
+	h := &packet.Header
+
+	if h.ID == DDP_ID_STATUS && s.device != nil {
+		s.answerStatus(packet, addr)
+		return true
+	}
+
+	var data []byte
+	if fb, exists := s.frames[h.ID]; exists {
+		fb.mu.Lock()
+		data = fb.snapshot()
+		fb.mu.Unlock()
+	} else if document, exists := s.documents[h.ID]; exists {
+		var err error
+		if data, err = document(); err != nil {
+			s.reportError(fmt.Errorf("document for ID %d: %w", h.ID, err))
+			data = nil
+		}
+	} else if s.registeredHandler(h.ID) != nil {
+		return false
+	} else {
+		// The ID can't be read
+		s.sendReply(addr, h.ID, 0, nil)
+		return true
+	}
+
+	s.sendReply(addr, h.ID, h.Offset, readRange(data, h.Offset, h.Length))
+	return true
+}
+
+// readRange returns length bytes of data starting at offset, or everything from
+// offset if length is 0. Ranges running past the end are cut short.
+func readRange(data []byte, offset uint32, length uint16) []byte {
+	if int64(offset) >= int64(len(data)) {
+		return nil
+	}
+	data = data[offset:]
+	if length != 0 && int(length) < len(data) {
+		data = data[:length]
+	}
+	return data
+}
+
+// sendReply sends a Reply, reporting any error
+func (s *DDPServer) sendReply(addr *net.UDPAddr, id byte, offset uint32, data []byte) {
+	if err := s.SendReply(addr, id, offset, data); err != nil {
+		s.reportError(fmt.Errorf("reply for ID %d to %s: %w", id, addr, err))
+	}
+}
@@ -0,0 +1,138 @@
+package ddp
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+// newQueryServer serves server over a memory transport and returns a controller connected to it
+func newQueryServer(t *testing.T, server *DDPServer) *DDPController {
+	t.Helper()
+
+	controllerEnd, serverEnd := NewMemoryTransportPair()
+	serveTransport(t, server, serverEnd)
+
+	controller := NewDDPController()
+	controller.Connect(controllerEnd)
+	t.Cleanup(func() { controller.Close() })
+	return controller
+}
+
+// Test queries are answered from the frame buffer
+func TestQueryFrameBuffer(t *testing.T) {
+	server := NewDDPServer()
+	server.SetDispatchMode(DispatchOrdered)
+
+	frames := make(chan []byte, 1)
+	server.RegisterFrameHandler(1, 0, func(id byte, frame []byte) error {
+		frames <- frame
+		return nil
+	})
+	controller := newQueryServer(t, server)
+
+	frame := make([]byte, 2000)
+	for i := range frame {
+		frame[i] = byte(i)
+	}
+	if _, err := controller.WriteFrame(frame); err != nil {
+		t.Fatalf("WriteFrame failed: %v", err)
+	}
+	select {
+	case <-frames:
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for frame")
+	}
+
+	// Spans two reply packets
+	data, err := controller.Query(1, 100, 1500)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if !bytes.Equal(data, frame[100:1600]) {
+		t.Errorf("Query returned %d bytes, expected frame[100:1600]", len(data))
+	}
+
+	// Reads past the end are cut short
+	data, err = controller.Query(1, 1990, 100)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if !bytes.Equal(data, frame[1990:]) {
+		t.Errorf("Query = %v, expected %v", data, frame[1990:])
+	}
+}
+
+// Test queries are answered from a registered JSON document
+func TestQueryJSONDocument(t *testing.T) {
+	server := NewDDPServer()
+	server.RegisterJSON(DDP_ID_STATUS, func() interface{} {
+		return statusDocument{Status: Status{Manufacturer: "coral", Model: "test"}}
+	})
+	controller := newQueryServer(t, server)
+
+	status, err := controller.GetStatus()
+	if err != nil {
+		t.Fatalf("GetStatus failed: %v", err)
+	}
+	if status.Manufacturer != "coral" || status.Model != "test" {
+		t.Errorf("Status = %+v, expected coral test", status)
+	}
+}
+
+// Test unreadable IDs get an empty reply instead of a timeout, even with a default handler
+func TestQueryUnreadable(t *testing.T) {
+	server := NewDDPServer()
+	server.RegisterDefaultHandler(func(packet *DDPPacket, addr *net.UDPAddr) error {
+		return nil
+	})
+	controller := newQueryServer(t, server)
+	controller.SetQueryTimeout(time.Second)
+
+	start := time.Now()
+	data, err := controller.Query(42, 0, 10)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(data) != 0 {
+		t.Errorf("Query = %v, expected no data", data)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("Query waited for a timeout, expected an immediate empty reply")
+	}
+}
+
+// Test queries for IDs with a packet handler still go to the handler
+func TestQueryHandler(t *testing.T) {
+	server := NewDDPServer()
+	server.RegisterHandler(2, func(packet *DDPPacket, addr *net.UDPAddr) error {
+		return server.SendReply(addr, 2, 0, []byte("handled"))
+	})
+	controller := newQueryServer(t, server)
+
+	data, err := controller.Query(2, 0, 0)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if string(data) != "handled" {
+		t.Errorf("Query = %q, expected %q", data, "handled")
+	}
+}
+
+// Test queries for IDs in a handler range go to the range handler
+func TestQueryHandlerRange(t *testing.T) {
+	server := NewDDPServer()
+	server.RegisterHandlerRange(2, 9, func(packet *DDPPacket, addr *net.UDPAddr) error {
+		return server.SendReply(addr, packet.Header.ID, 0, []byte("range"))
+	})
+	controller := newQueryServer(t, server)
+
+	data, err := controller.Query(5, 0, 0)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if string(data) != "range" {
+		t.Errorf("Query = %q, expected %q", data, "range")
+	}
+}
@@ -0,0 +1,134 @@
+package ddp
+
+import (
+	"net"
+	"sort"
+)
+
+// handlerRange is a handler registered for the IDs first to last
+type handlerRange struct {
+	first, last byte
+	handler     PacketHandler
+}
+
+// contains reports if id is in the range
+func (r handlerRange) contains(id byte) bool {
+	return id >= r.first && id <= r.last
+}
+
+// hasDisplayID reports if the range covers any display ID, see isDisplayID
+func (r handlerRange) hasDisplayID() bool {
+	for id := int(r.first); id <= int(r.last); id++ {
+		if isDisplayID(byte(id)) {
+			return true
+		}
+	}
+	return false
+}
+
+// width returns the number of IDs in the range
+func (r handlerRange) width() int {
+	return int(r.last) - int(r.first) + 1
+}
+
+// RegisterHandlerRange registers a handler for packets with IDs from first to last,
+// such as 2-249 for custom display IDs. Registering the same range again replaces its handler.
+//
+// Packets are routed to the handler registered for their exact ID, then to the
+// narrowest range containing it, ranges of equal width going by the lower first ID,
+// then to the default handler.
+func (s *DDPServer) RegisterHandlerRange(first, last byte, handler PacketHandler) {
+	if first > last {
+		first, last = last, first
+	}
+
+	for i, r := range s.ranges {
+		if r.first == first && r.last == last {
+			s.ranges[i].handler = handler
+			return
+		}
+	}
+
+	s.ranges = append(s.ranges, handlerRange{first: first, last: last, handler: handler})
+	sort.SliceStable(s.ranges, func(i, j int) bool {
+		if s.ranges[i].width() != s.ranges[j].width() {
+			return s.ranges[i].width() < s.ranges[j].width()
+		}
+		return s.ranges[i].first < s.ranges[j].first
+	})
+}
+
+// findHandler returns the handler for id: exact, then range, then default
+func (s *DDPServer) findHandler(id byte) PacketHandler {
+	if handler := s.registeredHandler(id); handler != nil {
+		return handler
+	}
+	return s.defaultHandler
+}
+
+// registeredHandler returns the exact or range handler for id, ignoring the default handler
+func (s *DDPServer) registeredHandler(id byte) PacketHandler {
+	if handler, exists := s.handlers[id]; exists {
+		return handler
+	}
+	// Ranges are kept narrowest first
+	for _, r := range s.ranges {
+		if r.contains(id) {
+			return r.handler
+		}
+	}
+	return nil
+}
+
+// isDisplayID reports if id can hold display data: the default output 1 and the
+// custom IDs 2-249, except DDP_ID_CONTROL. The rest are reserved or well known
+// JSON and DMX IDs.
+func isDisplayID(id byte) bool {
+	return id >= DDP_ID_DISPLAY && id <= 249 && id != DDP_ID_CONTROL
+}
+
+// handleAll delivers an "all devices" packet to every display ID with a frame buffer
+// or handler of its own, as a packet for that ID, and once to each range handler
+// covering a display ID as the DDP_ID_ALL packet. Returns false if DDP_ID_ALL has a handler registered,
+// or nothing takes the packet, so it is routed like any other ID.
+func (s *DDPServer) handleAll(packet *DDPPacket, addr *net.UDPAddr) bool {
+	if _, exists := s.handlers[DDP_ID_ALL]; exists {
+		return false
+	}
+
+	var ids []int
+	for id := range s.frames {
+		if isDisplayID(id) {
+			ids = append(ids, int(id))
+		}
+	}
+	for id := range s.handlers {
+		if _, exists := s.frames[id]; !exists && isDisplayID(id) {
+			ids = append(ids, int(id))
+		}
+	}
+	var ranges []handlerRange
+	for _, r := range s.ranges {
+		if r.hasDisplayID() {
+			ranges = append(ranges, r)
+		}
+	}
+	if len(ids) == 0 && len(ranges) == 0 {
+		return false
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		target := *packet
+		target.Header.ID = byte(id)
+		s.route(&target, addr)
+	}
+
+	// Ranges can't tell which of their IDs exist, so they see the packet as sent
+	for _, r := range ranges {
+		if err := r.handler(packet, addr); err != nil {
+			s.reportError(&HandlerError{ID: DDP_ID_ALL, Addr: addr, Err: err})
+		}
+	}
+	return true
+}
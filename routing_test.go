@@ -0,0 +1,127 @@
+package ddp
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// recordHandler returns a handler that appends name and the packet's ID to calls
+func recordHandler(calls *[]string, name string) PacketHandler {
+	return func(packet *DDPPacket, addr *net.UDPAddr) error {
+		*calls = append(*calls, fmt.Sprintf("%s:%d", name, packet.Header.ID))
+		return nil
+	}
+}
+
+// Test the default handler and an ID 255 handler don't replace each other
+func TestDefaultHandlerSeparateFromAll(t *testing.T) {
+	server := NewDDPServer()
+
+	var calls []string
+	server.RegisterHandler(DDP_ID_ALL, recordHandler(&calls, "all"))
+	server.RegisterDefaultHandler(recordHandler(&calls, "default"))
+	server.RegisterHandler(1, recordHandler(&calls, "one"))
+
+	controller, mock := newMockController()
+	controller.SetID(DDP_ID_ALL)
+	controller.Write([]byte{1})
+	controller.SetID(7)
+	controller.Write([]byte{1})
+	feedServer(t, server, mock)
+
+	// ID 255 has its own handler, so it isn't fanned out to ID 1
+	expected := []string{"all:255", "default:7"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Calls = %v, expected %v", calls, expected)
+	}
+}
+
+// Test exact IDs win over ranges, narrower ranges over wider ones, and ranges over the default
+func TestHandlerRangePrecedence(t *testing.T) {
+	server := NewDDPServer()
+
+	var calls []string
+	server.RegisterDefaultHandler(recordHandler(&calls, "default"))
+	server.RegisterHandlerRange(249, 2, recordHandler(&calls, "wide"))
+	server.RegisterHandlerRange(10, 19, recordHandler(&calls, "narrow"))
+	server.RegisterHandler(13, recordHandler(&calls, "exact"))
+
+	controller, mock := newMockController()
+	for _, id := range []byte{13, 14, 22, 1, 250} {
+		controller.SetID(id)
+		controller.Write([]byte{1})
+	}
+	feedServer(t, server, mock)
+
+	expected := []string{"exact:13", "narrow:14", "wide:22", "default:1", "default:250"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Calls = %v, expected %v", calls, expected)
+	}
+}
+
+// Test ID 255 packets reach every display ID but not the JSON IDs
+func TestAllDevicesFanOut(t *testing.T) {
+	server := NewDDPServer()
+
+	var calls []string
+	server.RegisterHandler(2, recordHandler(&calls, "two"))
+	server.RegisterHandler(3, recordHandler(&calls, "three"))
+	server.RegisterHandler(DDP_ID_CONTROL, recordHandler(&calls, "control"))
+	server.RegisterHandlerRange(100, 199, recordHandler(&calls, "range"))
+	server.RegisterHandlerRange(250, 254, recordHandler(&calls, "json"))
+	server.RegisterDefaultHandler(recordHandler(&calls, "default"))
+
+	var frames []byte
+	server.RegisterFrameHandler(1, 0, func(id byte, frame []byte) error {
+		frames = append(frames, id)
+		return nil
+	})
+
+	controller, mock := newMockController()
+	controller.SetID(DDP_ID_ALL)
+	controller.Write([]byte{1, 2, 3})
+	feedServer(t, server, mock)
+
+	expected := []string{"two:2", "three:3", "range:255"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Calls = %v, expected %v", calls, expected)
+	}
+	if !reflect.DeepEqual(frames, []byte{1}) {
+		t.Errorf("Frames displayed for IDs %v, expected [1]", frames)
+	}
+}
+
+// Test ranges covering only JSON and DMX IDs don't take ID 255 packets
+func TestAllDevicesSkipsNonDisplayRanges(t *testing.T) {
+	server := NewDDPServer()
+
+	var calls []string
+	server.RegisterHandlerRange(DDP_ID_CONTROL, DDP_ID_DMX, recordHandler(&calls, "range"))
+	server.RegisterDefaultHandler(recordHandler(&calls, "default"))
+
+	controller, mock := newMockController()
+	controller.SetID(DDP_ID_ALL)
+	controller.Write([]byte{1})
+	feedServer(t, server, mock)
+
+	// 246-254 includes 247-249, which are display IDs
+	expected := []string{"range:255"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Calls = %v, expected %v", calls, expected)
+	}
+
+	calls = nil
+	server = NewDDPServer()
+	server.RegisterHandlerRange(DDP_ID_CONFIG, DDP_ID_STATUS, recordHandler(&calls, "range"))
+	server.RegisterDefaultHandler(recordHandler(&calls, "default"))
+	controller.Write([]byte{1})
+	feedServer(t, server, mock)
+
+	// With nothing to fan out to, the packet goes to the default handler
+	expected = []string{"default:255"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Calls = %v, expected %v", calls, expected)
+	}
+}
@@ -0,0 +1,171 @@
+package ddp
+
+import (
+	"hash/fnv"
+	"net"
+	"sync"
+)
+
+// maxSequenceGap is the largest forward jump in sequence numbers counted as lost
+// packets, anything further ahead is taken as an old packet arriving out of order
+const maxSequenceGap = 8
+
+// SequenceSource is a sender and the ID it sends to
+type SequenceSource struct {
+	Addr string
+	ID   byte
+}
+
+// SequenceStats counts the packets from one sender to one ID that carry sequence numbers
+type SequenceStats struct {
+	Received   uint64 // packets received, including duplicates
+	Duplicates uint64 // back-to-back copies that were dropped
+	Lost       uint64 // estimated from gaps in the sequence
+	OutOfOrder uint64 // packets older than one already received
+}
+
+// sequenceState is what the server knows about one source
+type sequenceState struct {
+	last  byte   // last sequence number seen
+	hash  uint64 // hash of the last packet, to spot duplicates
+	stats SequenceStats
+}
+
+// sequenceTracker follows the sequence numbers of every source
+type sequenceTracker struct {
+	mu      sync.Mutex
+	sources map[sourceKey]*sequenceState
+}
+
+// track records a packet and reports whether it repeats the one before it from the
+// same source. Packets with sequence number 0 don't use sequencing and are ignored.
+func (t *sequenceTracker) track(data []byte, addr *net.UDPAddr) bool {
+	if len(data) < 10 || data[1] == 0 {
+		return false
+	}
+	seq := data[1] & 0x0f
+
+	h := fnv.New64a()
+	h.Write(data)
+	hash := h.Sum64()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.sources == nil {
+		t.sources = make(map[sourceKey]*sequenceState)
+	}
+	key := sourceKey{addr: addr.String(), id: data[3]}
+	state, exists := t.sources[key]
+	if !exists {
+		state = &sequenceState{}
+		t.sources[key] = state
+	}
+	state.stats.Received++
+
+	if !exists {
+		state.last, state.hash = seq, hash
+		return false
+	}
+
+	// Distance forward around the 1-15 cycle
+	distance := (int(seq) - int(state.last) + 15) % 15
+	switch {
+	case distance == 0:
+		if hash == state.hash {
+			state.stats.Duplicates++
+			return true
+		}
+	case distance < maxSequenceGap:
+		state.stats.Lost += uint64(distance - 1)
+	default:
+		state.stats.OutOfOrder++
+		return false
+	}
+
+	state.last, state.hash = seq, hash
+	return false
+}
+
+// SequenceStats returns the sequence counters of every sender and ID seen so far
+func (s *DDPServer) SequenceStats() map[SequenceSource]SequenceStats {
+	t := &s.sequences
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := make(map[SequenceSource]SequenceStats, len(t.sources))
+	for key, state := range t.sources {
+		stats[SequenceSource{Addr: key.addr, ID: key.id}] = state.stats
+	}
+	return stats
+}
+
+// SequenceMode controls how often a controller moves to the next sequence number
+type SequenceMode int
+
+const (
+	// SequencePerPacket gives every packet the next sequence number
+	SequencePerPacket SequenceMode = iota
+	// SequencePerFrame gives all packets of a frame the same sequence number,
+	// so receivers can tell which packets belong together
+	SequencePerFrame
+)
+
+// nextSequence moves to the next sequence number in the 1-15 cycle and returns it,
+// or returns 0 if sequencing is disabled
+func (c *DDPController) nextSequence() byte {
+	c.headerLock.Lock()
+	defer c.headerLock.Unlock()
+
+	seq := c.header.SequenceNumber
+	switch {
+	case seq == 0:
+		return 0
+	case seq >= 15:
+		seq = 1
+	default:
+		seq++
+	}
+
+	c.header.SequenceNumber = seq
+	return seq
+}
+
+// EnableSequence numbers packets from 1 to 15 and around again, so receivers can
+// spot lost and duplicate packets. Sequencing is on for new controllers, and
+// SetDefaultHeader turns it off if the header's sequence number is 0.
+func (c *DDPController) EnableSequence() {
+	c.headerLock.Lock()
+	defer c.headerLock.Unlock()
+
+	if c.header.SequenceNumber == 0 {
+		// Start so that the next packet is 1
+		c.header.SequenceNumber = 15
+	}
+}
+
+// DisableSequence sends every packet with sequence number 0, meaning not used
+func (c *DDPController) DisableSequence() {
+	c.headerLock.Lock()
+	defer c.headerLock.Unlock()
+
+	c.header.SequenceNumber = 0
+}
+
+// SetSequenceMode sets whether sequence numbers count packets or frames,
+// defaults to SequencePerPacket
+func (c *DDPController) SetSequenceMode(mode SequenceMode) {
+	c.headerLock.Lock()
+	defer c.headerLock.Unlock()
+
+	c.sequenceMode = mode
+}
+
+// SequenceNumber returns the sequence number of the last packet sent, for logging.
+// Returns 0 if sequencing is disabled.
+func (c *DDPController) SequenceNumber() byte {
+	c.headerLock.Lock()
+	defer c.headerLock.Unlock()
+
+	return c.header.SequenceNumber
+}
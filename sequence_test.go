@@ -0,0 +1,158 @@
+package ddp
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// sequencedPacket builds a packet to ID 1 with the given sequence number and data
+func sequencedPacket(seq byte, data ...byte) []byte {
+	h := DDPHeader{F1: ConfigFlag{Push: true}, SequenceNumber: seq, ID: 1, Length: uint16(len(data))}
+	return append(h.Bytes(), data...)
+}
+
+// Test duplicates, gaps and late packets are counted
+func TestSequenceTracking(t *testing.T) {
+	var tracker sequenceTracker
+
+	packets := []struct {
+		packet    []byte
+		duplicate bool
+	}{
+		{sequencedPacket(14, 1), false},
+		{sequencedPacket(14, 1), true},  // back-to-back copy
+		{sequencedPacket(15, 2), false}, // in order
+		{sequencedPacket(3, 3), false},  // wraps past 1 and 2, two lost
+		{sequencedPacket(2, 4), false},  // late
+		{sequencedPacket(3, 5), false},  // same number but different data
+		{sequencedPacket(0, 6), false},  // not sequenced
+	}
+
+	for i, p := range packets {
+		if duplicate := tracker.track(p.packet, testAddr); duplicate != p.duplicate {
+			t.Errorf("Packet %d duplicate = %v, expected %v", i, duplicate, p.duplicate)
+		}
+	}
+
+	state := tracker.sources[sourceKey{addr: testAddr.String(), id: 1}]
+	expected := SequenceStats{Received: 6, Duplicates: 1, Lost: 2, OutOfOrder: 1}
+	if state.stats != expected {
+		t.Errorf("Stats = %+v, expected %+v", state.stats, expected)
+	}
+}
+
+// Test the server drops duplicates before they reach handlers and reports stats per source
+func TestServerSequenceStats(t *testing.T) {
+	server := NewDDPServer()
+
+	var handled int32
+	server.RegisterFrameHandler(1, 0, func(id byte, frame []byte) error {
+		atomic.AddInt32(&handled, 1)
+		return nil
+	})
+
+	controllerEnd, serverEnd := NewMemoryTransportPair()
+	serveTransport(t, server, serverEnd)
+
+	for _, p := range [][]byte{sequencedPacket(1, 1), sequencedPacket(1, 1), sequencedPacket(2, 2), sequencedPacket(5, 3)} {
+		if err := controllerEnd.WritePacket(p, nil); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&handled) < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if n := atomic.LoadInt32(&handled); n != 3 {
+		t.Errorf("Handled %d frames, expected 3", n)
+	}
+
+	stats := server.SequenceStats()
+	source := SequenceSource{Addr: toUDPAddr(controllerEnd.LocalAddr()).String(), ID: 1}
+	expected := SequenceStats{Received: 4, Duplicates: 1, Lost: 2}
+	if stats[source] != expected {
+		t.Errorf("Stats = %+v, expected %+v", stats, expected)
+	}
+}
+
+// Test the controller cycles through 1-15 and can turn sequencing back on
+func TestControllerSequence(t *testing.T) {
+	controller, mock := newMockController()
+
+	for i := 0; i < 30; i++ {
+		controller.Write([]byte{1})
+	}
+	for i, p := range splitPackets(t, mock.data) {
+		if expected := byte(i+1)%15 + 1; p.Header.SequenceNumber != expected {
+			t.Errorf("Packet %d sequence number = %d, expected %d", i, p.Header.SequenceNumber, expected)
+		}
+	}
+	mock.data = nil
+
+	h := DefaultDDPHeader()
+	h.SequenceNumber = 0
+	controller.SetDefaultHeader(h)
+	controller.Write([]byte{1})
+	controller.EnableSequence()
+	controller.Write([]byte{1})
+	controller.Write([]byte{1})
+
+	packets := splitPackets(t, mock.data)
+	for i, expected := range []byte{0, 1, 2} {
+		if packets[i].Header.SequenceNumber != expected {
+			t.Errorf("Packet %d sequence number = %d, expected %d", i, packets[i].Header.SequenceNumber, expected)
+		}
+	}
+	if controller.SequenceNumber() != 2 {
+		t.Errorf("SequenceNumber() = %d, expected 2", controller.SequenceNumber())
+	}
+}
+
+// Test all packets of a frame share a sequence number in per-frame mode
+func TestSequencePerFrame(t *testing.T) {
+	controller, mock := newMockController()
+	controller.SetSequenceMode(SequencePerFrame)
+
+	controller.WriteFrame(make([]byte, DDP_MAX_DATALEN*3))
+	controller.WriteFrame(make([]byte, DDP_MAX_DATALEN*2))
+
+	packets := splitPackets(t, mock.data)
+	expected := []byte{2, 2, 2, 3, 3}
+	if len(packets) != len(expected) {
+		t.Fatalf("Got %d packets, expected %d", len(packets), len(expected))
+	}
+	for i := range expected {
+		if packets[i].Header.SequenceNumber != expected[i] {
+			t.Errorf("Packet %d sequence number = %d, expected %d", i, packets[i].Header.SequenceNumber, expected[i])
+		}
+	}
+}
+
+// Test writes and queries from several goroutines share the sequencer safely (run with -race)
+func TestControllerConcurrentSequence(t *testing.T) {
+	server := NewDDPServer()
+	server.RegisterFrameHandler(1, 0, func(id byte, frame []byte) error { return nil })
+	controller := newQueryServer(t, server)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			controller.Query(1, 0, 0)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if _, err := controller.Write([]byte{1, 2, 3}); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	<-done
+
+	if seq := controller.SequenceNumber(); seq < 1 || seq > 15 {
+		t.Errorf("SequenceNumber() = %d, expected 1-15", seq)
+	}
+}
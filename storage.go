@@ -0,0 +1,93 @@
+package ddp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// StorageUnit is pre-rendered data kept on the display, read from by storage packets
+type StorageUnit interface {
+	io.ReaderAt
+	io.Closer
+}
+
+// StorageProvider finds the storage unit named by a storage packet.
+// The name is whatever the sender put in the packet: a name, a number or a URL.
+type StorageProvider interface {
+	OpenStorage(name string) (StorageUnit, error)
+}
+
+// DirStorage is a StorageProvider serving the files in a local directory,
+// a storage unit named "show/intro" is the file show/intro in the directory.
+// Names can't reach outside the directory.
+type DirStorage string
+
+// OpenStorage opens the file for name in the directory
+func (d DirStorage) OpenStorage(name string) (StorageUnit, error) {
+	if name == "" {
+		return nil, errors.New("empty storage name")
+	}
+
+	// Cleaning the name as an absolute path drops any ".." that would escape the directory
+	clean := filepath.FromSlash(path.Clean("/" + name))
+	return os.Open(filepath.Join(string(d), clean))
+}
+
+// WriteStorage tells the display to fill its frame buffer from the storage unit
+// called name, starting offset bytes into it. The packet uses the default header,
+// so the display shows the data if the header has Push set.
+func (c *DDPController) WriteStorage(name string, offset uint32) (int, error) {
+	return c.WriteStorageContext(context.Background(), name, offset)
+}
+
+// WriteStorageContext is WriteStorage, giving up if ctx is done before the packet is sent
+func (c *DDPController) WriteStorageContext(ctx context.Context, name string, offset uint32) (int, error) {
+	if name == "" {
+		return 0, errors.New("empty storage name")
+	}
+
+	h := c.currentHeader()
+	h.F1.Storage = true
+	h.Offset = offset
+	return c.writePacket(ctx, h, []byte(name))
+}
+
+// SetStorageProvider sets where storage packets for IDs in display mode are read from.
+// Storage packets fill the whole frame buffer. Buffers registered with size 0 take
+// the rest of the unit from the packet's offset, up to MaxFrameSize.
+// Without a provider storage packets aren't displayed and are reported to the error handler.
+func (s *DDPServer) SetStorageProvider(provider StorageProvider) {
+	s.storage = provider
+}
+
+// readStorage reads from offset in the storage unit called name until the unit ends,
+// at most limit bytes. Data shorter than size is padded with zeros.
+func (s *DDPServer) readStorage(name string, offset uint32, size, limit int) ([]byte, error) {
+	if s.storage == nil {
+		return nil, errors.New("no storage provider")
+	}
+
+	// Some senders terminate the name like a C string
+	name = strings.TrimRight(name, "\x00")
+
+	unit, err := s.storage.OpenStorage(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open storage %q: %w", name, err)
+	}
+	defer unit.Close()
+
+	data, err := io.ReadAll(io.NewSectionReader(unit, int64(offset), int64(limit)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read storage %q: %w", name, err)
+	}
+	if len(data) < size {
+		data = append(data, make([]byte, size-len(data))...)
+	}
+	return data, nil
+}
@@ -0,0 +1,152 @@
+package ddp
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Test a storage packet fills the frame buffer from a file in the storage directory
+func TestStoragePlayback(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "show"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	sequence := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	if err := os.WriteFile(filepath.Join(dir, "show", "intro"), sequence, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewDDPServer()
+	server.SetStorageProvider(DirStorage(dir))
+
+	var frames [][]byte
+	server.RegisterFrameHandler(1, 6, func(id byte, frame []byte) error {
+		frames = append(frames, frame)
+		return nil
+	})
+
+	controller, mock := newMockController()
+
+	// Second frame runs past the end of the file, the rest is blank
+	if _, err := controller.WriteStorage("show/intro", 0); err != nil {
+		t.Fatalf("WriteStorage failed: %v", err)
+	}
+	if _, err := controller.WriteStorage("show/intro", 6); err != nil {
+		t.Fatalf("WriteStorage failed: %v", err)
+	}
+	feedServer(t, server, mock)
+
+	expected := [][]byte{{1, 2, 3, 4, 5, 6}, {7, 8, 9, 10, 0, 0}}
+	if len(frames) != len(expected) {
+		t.Fatalf("Got %d frames, expected %d", len(frames), len(expected))
+	}
+	for i := range expected {
+		if !bytes.Equal(frames[i], expected[i]) {
+			t.Errorf("Frame %d = %v, expected %v", i, frames[i], expected[i])
+		}
+	}
+}
+
+// Test the storage packet carries the name and offset with the Storage flag
+func TestWriteStoragePacket(t *testing.T) {
+	controller, mock := newMockController()
+
+	if _, err := controller.WriteStorage("42", 1200); err != nil {
+		t.Fatalf("WriteStorage failed: %v", err)
+	}
+
+	packets := splitPackets(t, mock.data)
+	if len(packets) != 1 {
+		t.Fatalf("Got %d packets, expected 1", len(packets))
+	}
+	p := packets[0]
+	if !p.Header.F1.Storage {
+		t.Error("Storage flag not set")
+	}
+	if p.Header.Offset != 1200 {
+		t.Errorf("Offset = %d, expected 1200", p.Header.Offset)
+	}
+	if string(p.Data) != "42" {
+		t.Errorf("Data = %q, expected %q", p.Data, "42")
+	}
+
+	if _, err := controller.WriteStorage("", 0); err == nil {
+		t.Error("Expected error for an empty storage name")
+	}
+}
+
+// Test storage names can't escape the storage directory
+func TestDirStorageEscape(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "storage")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "secret"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"../secret", "/../secret", "a/../../secret"} {
+		if unit, err := DirStorage(dir).OpenStorage(name); err == nil {
+			unit.Close()
+			t.Errorf("OpenStorage(%q) opened a file outside the directory", name)
+		}
+	}
+}
+
+// Test storage packets aren't displayed without a provider, and are reported
+func TestStorageWithoutProvider(t *testing.T) {
+	server, errs := collectErrors()
+
+	called := false
+	server.RegisterFrameHandler(1, 6, func(id byte, frame []byte) error {
+		called = true
+		return nil
+	})
+
+	controller, mock := newMockController()
+	controller.WriteStorage("show", 0)
+	feedServer(t, server, mock)
+
+	if called {
+		t.Error("Frame displayed without a storage provider")
+	}
+	if len(errs()) != 1 {
+		t.Errorf("Errors = %v, expected one for the missing provider", errs())
+	}
+}
+
+// Test a storage packet fills a frame buffer registered with size 0 from the unit
+func TestStorageGrowableBuffer(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "intro"), []byte{1, 2, 3, 4, 5, 6, 7, 8}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewDDPServer()
+	server.SetStorageProvider(DirStorage(dir))
+
+	var frames [][]byte
+	server.RegisterFrameHandler(1, 0, func(id byte, frame []byte) error {
+		frames = append(frames, frame)
+		return nil
+	})
+
+	controller, mock := newMockController()
+	controller.WriteStorage("intro", 2)
+	controller.WriteStorage("intro", 5)
+	feedServer(t, server, mock)
+
+	// The buffer keeps its size once grown, so the shorter read is padded
+	expected := [][]byte{{3, 4, 5, 6, 7, 8}, {6, 7, 8, 0, 0, 0}}
+	if len(frames) != len(expected) {
+		t.Fatalf("Got %d frames, expected %d", len(frames), len(expected))
+	}
+	for i := range expected {
+		if !bytes.Equal(frames[i], expected[i]) {
+			t.Errorf("Frame %d = %v, expected %v", i, frames[i], expected[i])
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package ddp
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultMaxLead is how far ahead a timecoded frame may be held by default, see SetMaxLead
+const DefaultMaxLead = 10 * time.Second
+
+// ErrTimecodeTooEarly is reported for timecoded frames further ahead than the maximum lead
+var ErrTimecodeTooEarly = errors.New("timecode too far ahead")
+
+// LatePolicy decides what happens to a timecoded frame whose time has already passed
+type LatePolicy int
+
+const (
+	// DisplayLate displays late frames as soon as they arrive
+	DisplayLate LatePolicy = iota
+	// DropLate never displays late frames
+	DropLate
+	// DropLaterThan displays late frames unless they are later than the threshold
+	DropLaterThan
+)
+
+// TimecodeReport describes how a single timecoded frame was handled
+type TimecodeReport struct {
+	ID       byte
+	Deadline time.Time     // when the frame was meant to be displayed
+	Received time.Time     // when the Push arrived
+	Lead     time.Duration // how early the Push arrived, negative if late
+	TooEarly bool          // Lead was over the maximum, so the frame was displayed at once
+	Dropped  bool          // the frame was not displayed because of the LatePolicy
+}
+
+// TimecodeStats counts timecoded frames since the server was created
+type TimecodeStats struct {
+	Early    uint64 // held until their deadline
+	TooEarly uint64 // further ahead than the maximum lead, displayed at once
+	Late     uint64 // arrived after their deadline, displayed or not
+	Dropped  uint64
+	MaxLate  time.Duration
+}
+
+// TimecodeHandler is called for every timecoded frame, before it is held or displayed
+type TimecodeHandler func(report TimecodeReport)
+
+// timecodeScheduler holds the timecode settings and statistics of a server
+type timecodeScheduler struct {
+	mu        sync.Mutex
+	policy    LatePolicy
+	threshold time.Duration
+	handler   TimecodeHandler
+	stats     TimecodeStats
+	maxLead   time.Duration // 0 means DefaultMaxLead
+
+	held    map[*heldFrame]struct{} // frames waiting for their deadline
+	stopped bool                    // the server stopped, frames are no longer held
+}
+
+// heldFrame is a timecoded frame waiting for its deadline
+type heldFrame struct {
+	timer *time.Timer
+}
+
+// SetLatePolicy sets what to do with timecoded frames that arrive after their
+// display time. The threshold is only used by DropLaterThan. Defaults to DisplayLate.
+func (s *DDPServer) SetLatePolicy(policy LatePolicy, threshold time.Duration) {
+	s.timecode.mu.Lock()
+	defer s.timecode.mu.Unlock()
+
+	s.timecode.policy = policy
+	s.timecode.threshold = threshold
+}
+
+// SetMaxLead sets how far ahead of its display time a timecoded frame may arrive
+// and still be held. Frames further ahead, usually from a bad clock, are displayed
+// at once and reported as ErrTimecodeTooEarly. Defaults to DefaultMaxLead.
+func (s *DDPServer) SetMaxLead(lead time.Duration) {
+	s.timecode.mu.Lock()
+	defer s.timecode.mu.Unlock()
+
+	s.timecode.maxLead = lead
+}
+
+// SetTimecodeHandler sets a callback reporting how early or late each timecoded frame was
+func (s *DDPServer) SetTimecodeHandler(handler TimecodeHandler) {
+	s.timecode.mu.Lock()
+	defer s.timecode.mu.Unlock()
+
+	s.timecode.handler = handler
+}
+
+// TimecodeStats returns the early/late counts of timecoded frames
+func (s *DDPServer) TimecodeStats() TimecodeStats {
+	s.timecode.mu.Lock()
+	defer s.timecode.mu.Unlock()
+
+	return s.timecode.stats
+}
+
+// schedule holds a timecoded frame until its display time, or applies the
+// LatePolicy if that time has already passed
+func (s *DDPServer) schedule(fb *frameBuffer, id byte, timecode uint32, frame []byte) {
+	now := time.Now()
+	deadline := NTPTimecodeToTime(timecode, now)
+	lead := deadline.Sub(now)
+
+	report := TimecodeReport{
+		ID:       id,
+		Deadline: deadline,
+		Received: now,
+		Lead:     lead,
+	}
+
+	tc := &s.timecode
+	tc.mu.Lock()
+	maxLead := tc.maxLead
+	if maxLead == 0 {
+		maxLead = DefaultMaxLead
+	}
+	if lead > maxLead {
+		tc.stats.TooEarly++
+		report.TooEarly = true
+	} else if lead > 0 {
+		tc.stats.Early++
+	} else {
+		tc.stats.Late++
+		if -lead > tc.stats.MaxLate {
+			tc.stats.MaxLate = -lead
+		}
+
+		switch tc.policy {
+		case DropLate:
+			report.Dropped = true
+		case DropLaterThan:
+			report.Dropped = -lead > tc.threshold
+		}
+		if report.Dropped {
+			tc.stats.Dropped++
+		}
+	}
+	handler := tc.handler
+	tc.mu.Unlock()
+
+	if handler != nil {
+		handler(report)
+	}
+	if report.TooEarly {
+		s.reportError(fmt.Errorf("%w: frame for ID %d is %v early, displaying it now", ErrTimecodeTooEarly, id, lead))
+	}
+
+	switch {
+	case report.Dropped:
+	case lead > 0 && !report.TooEarly:
+		s.hold(fb, id, frame, lead)
+	default:
+		s.present(fb, id, frame)
+	}
+}
+
+// hold displays frame after lead. Held frames count as running handlers until
+// they are displayed or the server stops and drops them.
+func (s *DDPServer) hold(fb *frameBuffer, id byte, frame []byte, lead time.Duration) {
+	tc := &s.timecode
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if tc.stopped {
+		return
+	}
+	if tc.held == nil {
+		tc.held = make(map[*heldFrame]struct{})
+	}
+
+	h := &heldFrame{}
+	s.inflight.Add(1)
+	h.timer = time.AfterFunc(lead, func() {
+		tc.mu.Lock()
+		_, waiting := tc.held[h]
+		delete(tc.held, h)
+		tc.mu.Unlock()
+
+		// Already dropped by releaseHeld
+		if !waiting {
+			return
+		}
+		defer s.inflight.Done()
+		s.present(fb, id, frame)
+	})
+	tc.held[h] = struct{}{}
+}
+
+// holdFrames lets timecoded frames be held again once the server starts serving
+func (s *DDPServer) holdFrames() {
+	s.timecode.mu.Lock()
+	defer s.timecode.mu.Unlock()
+
+	s.timecode.stopped = false
+}
+
+// releaseHeld stops holding timecoded frames and drops those still waiting,
+// so none are displayed after the server has stopped
+func (s *DDPServer) releaseHeld() {
+	tc := &s.timecode
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	tc.stopped = true
+	for h := range tc.held {
+		h.timer.Stop()
+		delete(tc.held, h)
+		s.inflight.Done()
+	}
+}
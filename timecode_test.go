@@ -0,0 +1,233 @@
+package ddp
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Test NTPTimecodeToTime reverses TimeToNTPTimecode
+func TestNTPTimecodeToTime(t *testing.T) {
+	now := time.Now()
+
+	for _, offset := range []time.Duration{0, 250 * time.Millisecond, -3 * time.Second, time.Hour, -5 * time.Hour} {
+		original := now.Add(offset)
+		converted := NTPTimecodeToTime(TimeToNTPTimecode(original), now)
+
+		// 16 bits of fraction is about 15 microseconds of resolution
+		if diff := converted.Sub(original); diff > 16*time.Microsecond || diff < -16*time.Microsecond {
+			t.Errorf("Offset %v: converted %v, expected %v (diff %v)", offset, converted, original, diff)
+		}
+	}
+}
+
+// Test NTPTimecodeToTime picks the nearest time across the 16-bit seconds wraparound
+func TestNTPTimecodeToTimeWraparound(t *testing.T) {
+	const ntpEpochOffset = 2208988800
+
+	// Just before the low 16 bits of NTP seconds wrap
+	ref := time.Unix(0x10000*40000-ntpEpochOffset-1, 0)
+
+	// A time 2 seconds later has wrapped to a small seconds value
+	later := ref.Add(2 * time.Second)
+	if tc := TimeToNTPTimecode(later); tc>>16 != 1 {
+		t.Fatalf("Timecode seconds = %d, expected 1", tc>>16)
+	}
+	if converted := NTPTimecodeToTime(TimeToNTPTimecode(later), ref); !converted.Equal(later) {
+		t.Errorf("Converted %v, expected %v", converted, later)
+	}
+
+	// And going back across the wrap from the other side
+	earlier := ref.Add(-2 * time.Second)
+	if converted := NTPTimecodeToTime(TimeToNTPTimecode(earlier), later); !converted.Equal(earlier) {
+		t.Errorf("Converted %v, expected %v", converted, earlier)
+	}
+}
+
+// sendTimecodedFrame writes a frame with a timecode lead from now through the server
+func sendTimecodedFrame(t *testing.T, server *DDPServer, lead time.Duration) {
+	t.Helper()
+
+	controller, mock := newMockController()
+	controller.SetTimecode(NTPTimecodeFromDuration(lead))
+	if _, err := controller.Write([]byte{1, 2, 3}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	feedServer(t, server, mock)
+}
+
+// Test an early frame is held until its timecode
+func TestTimecodeHoldsFrame(t *testing.T) {
+	server := NewDDPServer()
+
+	displayed := make(chan time.Time, 1)
+	server.RegisterFrameHandler(1, 3, func(id byte, frame []byte) error {
+		displayed <- time.Now()
+		return nil
+	})
+
+	var report TimecodeReport
+	server.SetTimecodeHandler(func(r TimecodeReport) {
+		report = r
+	})
+
+	start := time.Now()
+	sendTimecodedFrame(t, server, 100*time.Millisecond)
+
+	select {
+	case at := <-displayed:
+		if held := at.Sub(start); held < 90*time.Millisecond {
+			t.Errorf("Frame displayed after %v, expected about 100ms", held)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for frame")
+	}
+
+	if report.Lead <= 0 || report.Dropped {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	if stats := server.TimecodeStats(); stats.Early != 1 || stats.Late != 0 {
+		t.Errorf("Stats = %+v, expected 1 early", stats)
+	}
+}
+
+// Test late frames under each LatePolicy
+func TestTimecodeLatePolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    LatePolicy
+		threshold time.Duration
+		lateness  time.Duration
+		displayed bool
+	}{
+		{"display late", DisplayLate, 0, time.Second, true},
+		{"drop late", DropLate, 0, 10 * time.Millisecond, false},
+		{"within threshold", DropLaterThan, 500 * time.Millisecond, 100 * time.Millisecond, true},
+		{"past threshold", DropLaterThan, 500 * time.Millisecond, time.Second, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewDDPServer()
+			server.SetLatePolicy(tt.policy, tt.threshold)
+
+			displayed := false
+			server.RegisterFrameHandler(1, 3, func(id byte, frame []byte) error {
+				displayed = true
+				return nil
+			})
+
+			var report TimecodeReport
+			server.SetTimecodeHandler(func(r TimecodeReport) {
+				report = r
+			})
+
+			sendTimecodedFrame(t, server, -tt.lateness)
+
+			if displayed != tt.displayed {
+				t.Errorf("Displayed = %v, expected %v", displayed, tt.displayed)
+			}
+			if report.Dropped == tt.displayed {
+				t.Errorf("Report dropped = %v, expected %v", report.Dropped, !tt.displayed)
+			}
+			if report.Lead >= 0 {
+				t.Errorf("Report lead = %v, expected negative", report.Lead)
+			}
+
+			stats := server.TimecodeStats()
+			if stats.Late != 1 {
+				t.Errorf("Late = %d, expected 1", stats.Late)
+			}
+			if stats.MaxLate < tt.lateness-time.Millisecond {
+				t.Errorf("MaxLate = %v, expected at least %v", stats.MaxLate, tt.lateness)
+			}
+		})
+	}
+}
+
+// Test frames without a timecode are displayed straight away
+func TestTimecodeNotSet(t *testing.T) {
+	server := NewDDPServer()
+
+	displayed := false
+	server.RegisterFrameHandler(1, 3, func(id byte, frame []byte) error {
+		displayed = true
+		return nil
+	})
+	server.SetTimecodeHandler(func(r TimecodeReport) {
+		t.Error("Timecode handler called for a frame without timecode")
+	})
+
+	controller, mock := newMockController()
+	controller.Write([]byte{1, 2, 3})
+	feedServer(t, server, mock)
+
+	if !displayed {
+		t.Error("Frame was not displayed")
+	}
+}
+
+// Test frames further ahead than the maximum lead are displayed at once and reported
+func TestTimecodeMaxLead(t *testing.T) {
+	server, errs := collectErrors()
+	server.SetMaxLead(time.Second)
+
+	displayed := 0
+	server.RegisterFrameHandler(1, 3, func(id byte, frame []byte) error {
+		displayed++
+		return nil
+	})
+
+	sendTimecodedFrame(t, server, time.Hour)
+
+	if displayed != 1 {
+		t.Errorf("Displayed %d frames, expected 1 at once", displayed)
+	}
+	if stats := server.TimecodeStats(); stats.TooEarly != 1 || stats.Early != 0 {
+		t.Errorf("Stats = %+v, expected 1 too early", stats)
+	}
+	if reported := errs(); len(reported) != 1 || !errors.Is(reported[0], ErrTimecodeTooEarly) {
+		t.Errorf("Reported %v, expected ErrTimecodeTooEarly", reported)
+	}
+}
+
+// Test held frames are dropped when the server stops instead of delaying shutdown
+func TestTimecodeHeldFramesStop(t *testing.T) {
+	server := NewDDPServer()
+	server.SetShutdownTimeout(100 * time.Millisecond)
+
+	displayed := make(chan struct{}, 1)
+	server.RegisterFrameHandler(1, 3, func(id byte, frame []byte) error {
+		displayed <- struct{}{}
+		return nil
+	})
+
+	controllerEnd, serverEnd := NewMemoryTransportPair()
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		result <- server.ServeTransport(ctx, serverEnd)
+	}()
+
+	h := DDPHeader{F1: ConfigFlag{Push: true, Timecode: true}, ID: 1, Length: 3, Timecode: NTPTimecodeFromDuration(300 * time.Millisecond)}
+	if err := controllerEnd.WritePacket(append(h.Bytes(), 1, 2, 3), nil); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for server.TimecodeStats().Early == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	if err := <-result; err != nil {
+		t.Errorf("ServeTransport returned %v, expected nil", err)
+	}
+
+	select {
+	case <-displayed:
+		t.Error("Held frame was displayed after the server stopped")
+	case <-time.After(400 * time.Millisecond):
+	}
+}
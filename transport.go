@@ -0,0 +1,333 @@
+package ddp
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Transport carries whole DDP packets for a controller or a server.
+// ReadPacket returns one packet and where it came from, WritePacket sends one
+// packet to addr, or to the transport's peer if addr is nil.
+type Transport interface {
+	ReadPacket(buf []byte) (n int, addr net.Addr, err error)
+	WritePacket(packet []byte, addr net.Addr) error
+	LocalAddr() net.Addr
+	Close() error
+}
+
+// udpTransport sends and receives packets as UDP datagrams
+type udpTransport struct {
+	conn net.PacketConn
+}
+
+// NewUDPTransport returns a Transport over a UDP socket. A connected socket
+// (from net.DialUDP) writes to its peer when no address is given.
+func NewUDPTransport(conn net.PacketConn) Transport {
+	return &udpTransport{conn: conn}
+}
+
+func (t *udpTransport) ReadPacket(buf []byte) (int, net.Addr, error) {
+	return t.conn.ReadFrom(buf)
+}
+
+func (t *udpTransport) WritePacket(packet []byte, addr net.Addr) error {
+	if addr == nil {
+		conn, ok := t.conn.(net.Conn)
+		if !ok {
+			return errors.New("no address to send to")
+		}
+		_, err := conn.Write(packet)
+		return err
+	}
+	_, err := t.conn.WriteTo(packet, addr)
+	return err
+}
+
+func (t *udpTransport) LocalAddr() net.Addr {
+	return t.conn.LocalAddr()
+}
+
+func (t *udpTransport) Close() error {
+	return t.conn.Close()
+}
+
+func (t *udpTransport) SetWriteDeadline(deadline time.Time) error {
+	return t.conn.SetWriteDeadline(deadline)
+}
+
+// readFramedPacket reads one packet from a byte stream, using the header's
+// timecode flag and Length to find where it ends. Queries carry no data, as their
+// Length is how much to read. That includes STATUS queries, so {"mac":...} requests
+// in their body only work over packet transports such as UDP.
+func readFramedPacket(r io.Reader, buf []byte) (int, error) {
+	if len(buf) < 14 {
+		return 0, io.ErrShortBuffer
+	}
+
+	if _, err := io.ReadFull(r, buf[:10]); err != nil {
+		return 0, err
+	}
+
+	var flags ConfigFlag
+	flags.FromByte(buf[0])
+
+	n := 10
+	if flags.Timecode {
+		if _, err := io.ReadFull(r, buf[10:14]); err != nil {
+			return 0, err
+		}
+		n = 14
+	}
+
+	length := int(binary.BigEndian.Uint16(buf[8:10]))
+	if flags.Query && !flags.Reply {
+		length = 0
+	}
+	if n+length > len(buf) {
+		return 0, io.ErrShortBuffer
+	}
+
+	if _, err := io.ReadFull(r, buf[n:n+length]); err != nil {
+		return 0, err
+	}
+	return n + length, nil
+}
+
+// streamTransport sends and receives packets over a single TCP connection
+type streamTransport struct {
+	conn net.Conn
+	mu   sync.Mutex // keeps concurrent packets from interleaving
+}
+
+// NewStreamTransport returns a Transport over a stream connection such as TCP.
+// Packet boundaries are found from the header, see readFramedPacket.
+func NewStreamTransport(conn net.Conn) Transport {
+	return &streamTransport{conn: conn}
+}
+
+func (t *streamTransport) ReadPacket(buf []byte) (int, net.Addr, error) {
+	n, err := readFramedPacket(t.conn, buf)
+	return n, t.conn.RemoteAddr(), err
+}
+
+func (t *streamTransport) WritePacket(packet []byte, addr net.Addr) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, err := t.conn.Write(packet)
+	return err
+}
+
+func (t *streamTransport) LocalAddr() net.Addr {
+	return t.conn.LocalAddr()
+}
+
+func (t *streamTransport) Close() error {
+	return t.conn.Close()
+}
+
+func (t *streamTransport) SetWriteDeadline(deadline time.Time) error {
+	return t.conn.SetWriteDeadline(deadline)
+}
+
+// receivedPacket is a packet read by one of the connections of a listenerTransport
+type receivedPacket struct {
+	data []byte
+	addr net.Addr
+}
+
+// listenerTransport accepts stream connections and receives packets from all of them.
+// Packets written to an address go back out on the connection from that address.
+type listenerTransport struct {
+	listener net.Listener
+	packets  chan receivedPacket
+	done     chan struct{}
+
+	mu    sync.Mutex
+	conns map[string]*streamTransport
+}
+
+// NewListenerTransport returns a Transport serving every connection accepted on listener,
+// such as a TCP listener
+func NewListenerTransport(listener net.Listener) Transport {
+	t := &listenerTransport{
+		listener: listener,
+		packets:  make(chan receivedPacket),
+		done:     make(chan struct{}),
+		conns:    make(map[string]*streamTransport),
+	}
+	go t.accept()
+	return t
+}
+
+// accept starts a reader for each new connection
+func (t *listenerTransport) accept() {
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		stream := &streamTransport{conn: conn}
+		key := conn.RemoteAddr().String()
+
+		t.mu.Lock()
+		t.conns[key] = stream
+		t.mu.Unlock()
+
+		go t.read(key, stream)
+	}
+}
+
+// read passes packets from a connection on until it is closed
+func (t *listenerTransport) read(key string, stream *streamTransport) {
+	defer func() {
+		t.mu.Lock()
+		delete(t.conns, key)
+		t.mu.Unlock()
+		stream.Close()
+	}()
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := stream.ReadPacket(buf)
+		if err != nil {
+			return
+		}
+
+		data := make([]byte, n)
+		copy(data, buf[:n])
+
+		select {
+		case t.packets <- receivedPacket{data: data, addr: addr}:
+		case <-t.done:
+			return
+		}
+	}
+}
+
+func (t *listenerTransport) ReadPacket(buf []byte) (int, net.Addr, error) {
+	select {
+	case p := <-t.packets:
+		if len(p.data) > len(buf) {
+			return 0, p.addr, io.ErrShortBuffer
+		}
+		return copy(buf, p.data), p.addr, nil
+	case <-t.done:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+func (t *listenerTransport) WritePacket(packet []byte, addr net.Addr) error {
+	if addr == nil {
+		return errors.New("no address to send to")
+	}
+
+	t.mu.Lock()
+	stream, ok := t.conns[addr.String()]
+	t.mu.Unlock()
+
+	if !ok {
+		return errors.New("no connection from " + addr.String())
+	}
+	return stream.WritePacket(packet, nil)
+}
+
+func (t *listenerTransport) LocalAddr() net.Addr {
+	return t.listener.Addr()
+}
+
+func (t *listenerTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	select {
+	case <-t.done:
+		return net.ErrClosed
+	default:
+	}
+	close(t.done)
+
+	for _, stream := range t.conns {
+		stream.Close()
+	}
+	return t.listener.Close()
+}
+
+// memoryAddr is the address of one end of a memory transport
+type memoryAddr string
+
+func (a memoryAddr) Network() string { return "memory" }
+func (a memoryAddr) String() string  { return string(a) }
+
+// memoryTransport is one end of an in-memory pipe of packets
+type memoryTransport struct {
+	addr     memoryAddr
+	incoming chan []byte
+	peer     *memoryTransport
+
+	once sync.Once
+	done chan struct{}
+}
+
+// NewMemoryTransportPair returns two connected in-memory transports, packets
+// written to one are read from the other. Useful for tests.
+func NewMemoryTransportPair() (Transport, Transport) {
+	a := &memoryTransport{addr: "memory-a", incoming: make(chan []byte, 64), done: make(chan struct{})}
+	b := &memoryTransport{addr: "memory-b", incoming: make(chan []byte, 64), done: make(chan struct{})}
+	a.peer, b.peer = b, a
+	return a, b
+}
+
+func (t *memoryTransport) ReadPacket(buf []byte) (int, net.Addr, error) {
+	select {
+	case <-t.done:
+		return 0, nil, net.ErrClosed
+	default:
+	}
+
+	select {
+	case p := <-t.incoming:
+		if len(p) > len(buf) {
+			return 0, t.peer.addr, io.ErrShortBuffer
+		}
+		return copy(buf, p), t.peer.addr, nil
+	case <-t.done:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+func (t *memoryTransport) WritePacket(packet []byte, addr net.Addr) error {
+	p := make([]byte, len(packet))
+	copy(p, packet)
+
+	select {
+	case <-t.done:
+		return net.ErrClosed
+	case <-t.peer.done:
+		return net.ErrClosed
+	default:
+	}
+
+	select {
+	case t.peer.incoming <- p:
+		return nil
+	case <-t.peer.done:
+		return net.ErrClosed
+	case <-t.done:
+		return net.ErrClosed
+	}
+}
+
+func (t *memoryTransport) LocalAddr() net.Addr {
+	return t.addr
+}
+
+func (t *memoryTransport) Close() error {
+	t.once.Do(func() { close(t.done) })
+	return nil
+}
@@ -0,0 +1,166 @@
+package ddp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// Test packets are framed from a stream by their header
+func TestReadFramedPacket(t *testing.T) {
+	data := DDPHeader{F1: ConfigFlag{Push: true}, ID: 1, Length: 3}
+	timecoded := DDPHeader{F1: ConfigFlag{Timecode: true, Push: true}, ID: 1, Length: 2, Timecode: 0x12345678}
+	query := DDPHeader{F1: ConfigFlag{Query: true}, ID: DDP_ID_STATUS, Length: 500}
+	reply := DDPHeader{F1: ConfigFlag{Query: true, Reply: true}, ID: DDP_ID_STATUS, Length: 1}
+
+	packets := [][]byte{
+		append(data.Bytes(), 1, 2, 3),
+		append(timecoded.Bytes(), 4, 5),
+		query.Bytes(), // queries carry no data whatever their length
+		append(reply.Bytes(), 6),
+	}
+
+	var stream bytes.Buffer
+	for _, p := range packets {
+		stream.Write(p)
+	}
+
+	buf := make([]byte, maxPacketSize)
+	for i, expected := range packets {
+		n, err := readFramedPacket(&stream, buf)
+		if err != nil {
+			t.Fatalf("Packet %d: read failed: %v", i, err)
+		}
+		if !bytes.Equal(buf[:n], expected) {
+			t.Errorf("Packet %d = %v, expected %v", i, buf[:n], expected)
+		}
+	}
+
+	if _, err := readFramedPacket(&stream, buf); err != io.EOF {
+		t.Errorf("Error at end of stream = %v, expected EOF", err)
+	}
+}
+
+// Test a packet cut short in the stream
+func TestReadFramedPacketTruncated(t *testing.T) {
+	h := DDPHeader{ID: 1, Length: 10}
+	stream := bytes.NewReader(append(h.Bytes(), 1, 2, 3))
+
+	if _, err := readFramedPacket(stream, make([]byte, maxPacketSize)); err != io.ErrUnexpectedEOF {
+		t.Errorf("Error = %v, expected ErrUnexpectedEOF", err)
+	}
+}
+
+// serveTransport serves t until the test ends
+func serveTransport(t *testing.T, server *DDPServer, transport Transport) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		result <- server.ServeTransport(ctx, transport)
+	}()
+
+	for server.Addr() == nil {
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Cleanup(func() {
+		cancel()
+		<-result
+	})
+}
+
+// testTransportRoundtrip sends a multi-packet frame and a query over a connected controller
+func testTransportRoundtrip(t *testing.T, server *DDPServer, controller *DDPController) {
+	t.Helper()
+
+	// The server reports what it received on ID 2 back through a query
+	frames := make(chan []byte, 1)
+	server.RegisterFrameHandler(1, 0, func(id byte, frame []byte) error {
+		frames <- frame
+		return nil
+	})
+	server.RegisterHandler(2, func(packet *DDPPacket, addr *net.UDPAddr) error {
+		if packet.Header.F1.Query {
+			return server.SendReply(addr, 2, 0, []byte("hello"))
+		}
+		return nil
+	})
+
+	frame := make([]byte, 1000*3)
+	for i := range frame {
+		frame[i] = byte(i)
+	}
+	if _, err := controller.WriteFrame(frame); err != nil {
+		t.Fatalf("WriteFrame failed: %v", err)
+	}
+
+	select {
+	case received := <-frames:
+		if !bytes.Equal(received, frame) {
+			t.Error("Received frame does not match sent frame")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for frame")
+	}
+
+	data, err := controller.Query(2, 0, 5)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if string(data) != "hello" {
+		t.Errorf("Query = %q, expected %q", data, "hello")
+	}
+}
+
+// Test a controller and server talking over TCP
+func TestTCPTransport(t *testing.T) {
+	server := NewDDPServer()
+	server.SetDispatchMode(DispatchOrdered)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	serveTransport(t, server, NewListenerTransport(listener))
+
+	controller := NewDDPController()
+	if err := controller.ConnectTCP(listener.Addr().String()); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer controller.Close()
+
+	testTransportRoundtrip(t, server, controller)
+}
+
+// Test a controller and server talking over an in-memory transport
+func TestMemoryTransport(t *testing.T) {
+	server := NewDDPServer()
+	server.SetDispatchMode(DispatchOrdered)
+
+	controllerEnd, serverEnd := NewMemoryTransportPair()
+	serveTransport(t, server, serverEnd)
+
+	controller := NewDDPController()
+	controller.Connect(controllerEnd)
+	defer controller.Close()
+
+	testTransportRoundtrip(t, server, controller)
+}
+
+// Test writing to a closed memory transport fails
+func TestMemoryTransportClosed(t *testing.T) {
+	a, b := NewMemoryTransportPair()
+	b.Close()
+
+	if err := a.WritePacket([]byte{1}, nil); err != net.ErrClosed {
+		t.Errorf("Error = %v, expected net.ErrClosed", err)
+	}
+	if _, _, err := b.ReadPacket(make([]byte, 10)); err != net.ErrClosed {
+		t.Errorf("Error = %v, expected net.ErrClosed", err)
+	}
+}